@@ -0,0 +1,141 @@
+package builder
+
+import (
+	"time"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+// LiveWindow is a media playlist builder for live streams that only keeps the
+// most recent segments. The oldest segments are removed once the playlist holds
+// more segments or a longer duration than allowed, but never while the
+// remaining segments would last less than three target durations.
+// MediaSequence and DiscontinuitySequence are increased for every removed
+// segment and discontinuity, and date ranges that ended before the program
+// date time of the first remaining segment are removed with it.
+//
+// Segments are never removed from playlists with a PlaylistType, as EVENT
+// and VOD playlists may only grow.
+type LiveWindow struct {
+	*MediaPlaylist
+}
+
+// NewLiveWindow creates a live window of at most maxSegments segments and
+// maxDuration seconds. A limit of 0 is not applied.
+func NewLiveWindow(maxSegments int, maxDuration float64) *LiveWindow {
+	b := NewMediaPlaylist()
+	if maxSegments < 0 {
+		b.fail("invalid maximum number of segments %d", maxSegments)
+	}
+	if maxDuration < 0 {
+		b.fail("invalid maximum duration %g", maxDuration)
+	}
+	b.maxSegments = maxSegments
+	b.maxDuration = maxDuration
+	return &LiveWindow{MediaPlaylist: b}
+}
+
+// Finalize ends the stream by adding #EXT-X-ENDLIST and returns the final
+// playlist. An EVENT playlist keeps its type, which must not change, but
+// becomes a complete presentation like a VOD playlist.
+func (w *LiveWindow) Finalize() (*parser.Manifest, error) {
+	w.EndList()
+	return w.Build()
+}
+
+// evict removes the oldest segments once the playlist exceeds the limits of
+// a live window
+func (b *MediaPlaylist) evict() {
+	if (b.maxSegments == 0 && b.maxDuration == 0) || b.manifest.PlaylistType != "" {
+		return
+	}
+
+	segments := b.manifest.Segments
+	total := 0.0
+	for _, segment := range segments {
+		total += segment.Duration
+	}
+
+	targetDuration := b.targetDuration
+	if targetDuration == 0 {
+		targetDuration = b.longest
+	}
+
+	removed := 0
+	for removed < len(segments)-1 {
+		count := len(segments) - removed
+		if !(b.maxSegments > 0 && count > b.maxSegments) && !(b.maxDuration > 0 && total > b.maxDuration) {
+			break
+		}
+
+		first := segments[removed]
+		if total-first.Duration < float64(3*targetDuration) {
+			break
+		}
+
+		total -= first.Duration
+		if first.Discontinuity {
+			b.manifest.DiscontinuitySequence++
+		}
+		removed++
+	}
+
+	if removed == 0 {
+		return
+	}
+
+	b.manifest.Segments = append([]*parser.Segment{}, segments[removed:]...)
+	b.manifest.MediaSequence += removed
+
+	starts := []int{}
+	for _, start := range b.manifest.DiscontinuityStarts {
+		if start >= removed {
+			starts = append(starts, start-removed)
+		}
+	}
+	b.manifest.DiscontinuityStarts = starts
+
+	// keep the program date time on the first segment, copying it so that
+	// manifests built before are not modified
+	first := b.manifest.Segments[0]
+	if first.DateTimeObject.IsZero() && first.ProgramDateTime != 0 {
+		copied := *first
+		copied.DateTimeObject = time.Unix(0, first.ProgramDateTime*int64(time.Millisecond)).UTC()
+		b.manifest.Segments[0] = &copied
+		first = &copied
+	}
+	if !first.DateTimeObject.IsZero() {
+		b.manifest.DateTimeObject = first.DateTimeObject
+		b.expireDateRanges(first.DateTimeObject)
+	}
+}
+
+// expireDateRanges removes the date ranges that ended before start. Date
+// ranges without an end date or duration end when the next date range of the
+// same class starts.
+func (b *MediaPlaylist) expireDateRanges(start time.Time) {
+	dateRanges := b.manifest.DateRanges
+	kept := make([]*parser.DateRange, 0, len(dateRanges))
+
+	for _, dateRange := range dateRanges {
+		end := dateRange.EndDate
+		if end.IsZero() && dateRange.Duration > 0 {
+			end = dateRange.StartDate.Add(time.Duration(dateRange.Duration * float64(time.Second)))
+		}
+		if end.IsZero() && dateRange.Class != "" {
+			for _, next := range dateRanges {
+				if next.Class == dateRange.Class && next.StartDate.After(dateRange.StartDate) &&
+					(end.IsZero() || next.StartDate.Before(end)) {
+					end = next.StartDate
+				}
+			}
+		}
+
+		if !end.IsZero() && !end.After(start) {
+			continue
+		}
+		kept = append(kept, dateRange)
+	}
+
+	b.manifest.DateRanges = kept
+}
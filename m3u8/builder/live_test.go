@@ -0,0 +1,155 @@
+package builder
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+// segmentURIs returns the URIs of the segments of a manifest
+func segmentURIs(manifest *parser.Manifest) []string {
+	uris := []string{}
+	for _, segment := range manifest.Segments {
+		uris = append(uris, segment.URI)
+	}
+	return uris
+}
+
+func TestLiveWindowEviction(t *testing.T) {
+	tests := []struct {
+		name          string
+		maxSegments   int
+		maxDuration   float64
+		duration      float64
+		segments      int
+		wantSequence  int
+		wantSegments  int
+		targetSeconds int
+	}{
+		{"segment limit", 3, 0, 2, 6, 3, 3, 2},
+		{"duration limit", 0, 8, 2, 6, 2, 4, 2},
+		// three target durations last 12 seconds, so three segments of 4
+		// seconds are kept despite the limit of two
+		{"three target durations", 2, 0, 4, 5, 2, 3, 4},
+		{"no limit", 0, 0, 2, 6, 0, 6, 2},
+	}
+
+	for _, test := range tests {
+		w := NewLiveWindow(test.maxSegments, test.maxDuration)
+		w.TargetDuration(test.targetSeconds)
+		for i := 1; i <= test.segments; i++ {
+			w.Segment(fmt.Sprintf("segment%d.ts", i), test.duration)
+		}
+
+		manifest, err := w.Build()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		parsed := roundTrip(t, manifest)
+
+		if parsed.MediaSequence != test.wantSequence {
+			t.Errorf("%s: got media sequence %d, want %d", test.name, parsed.MediaSequence, test.wantSequence)
+		}
+		if len(parsed.Segments) != test.wantSegments {
+			t.Errorf("%s: got segments %v, want %d", test.name, segmentURIs(parsed), test.wantSegments)
+			continue
+		}
+		want := fmt.Sprintf("segment%d.ts", test.segments-test.wantSegments+1)
+		if parsed.Segments[0].URI != want {
+			t.Errorf("%s: got first segment %s, want %s", test.name, parsed.Segments[0].URI, want)
+		}
+	}
+}
+
+func TestLiveWindowDiscontinuitySequence(t *testing.T) {
+	w := NewLiveWindow(3, 0)
+	w.TargetDuration(2)
+	w.Segment("segment1.ts", 2)
+	w.Discontinuity().Segment("segment2.ts", 2)
+	w.Segment("segment3.ts", 2)
+	w.Discontinuity().Segment("segment4.ts", 2)
+	w.Segment("segment5.ts", 2)
+	w.Segment("segment6.ts", 2)
+
+	manifest, err := w.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := roundTrip(t, manifest)
+
+	if parsed.DiscontinuitySequence != 1 {
+		t.Errorf("got discontinuity sequence %d, want 1", parsed.DiscontinuitySequence)
+	}
+	if parsed.MediaSequence != 3 {
+		t.Errorf("got media sequence %d, want 3", parsed.MediaSequence)
+	}
+	if len(parsed.DiscontinuityStarts) != 1 || parsed.DiscontinuityStarts[0] != 0 {
+		t.Errorf("got discontinuity starts %v, want [0]", parsed.DiscontinuityStarts)
+	}
+}
+
+func TestLiveWindowPlaylistType(t *testing.T) {
+	w := NewLiveWindow(2, 0)
+	w.TargetDuration(2).PlaylistType("EVENT")
+	for i := 1; i <= 6; i++ {
+		w.Segment(fmt.Sprintf("segment%d.ts", i), 2)
+	}
+
+	manifest, err := w.Finalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := roundTrip(t, manifest)
+
+	if len(parsed.Segments) != 6 || parsed.MediaSequence != 0 || !parsed.EndList {
+		t.Errorf("got segments %v from media sequence %d, endlist %v", segmentURIs(parsed), parsed.MediaSequence, parsed.EndList)
+	}
+}
+
+func TestLiveWindowDateRanges(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	w := NewLiveWindow(3, 0)
+	w.TargetDuration(2).ProgramDateTime(start)
+	w.DateRange(&parser.DateRange{ID: "ended", StartDate: start, Duration: 4})
+	w.DateRange(&parser.DateRange{ID: "open", StartDate: start.Add(2 * time.Second)})
+	w.DateRange(&parser.DateRange{ID: "first", Class: "com.example.ad", StartDate: start})
+	w.DateRange(&parser.DateRange{ID: "second", Class: "com.example.ad", StartDate: start.Add(4 * time.Second)})
+	for i := 1; i <= 6; i++ {
+		w.Segment(fmt.Sprintf("segment%d.ts", i), 2)
+	}
+
+	manifest, err := w.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := roundTrip(t, manifest)
+
+	// the first remaining segment starts 6 seconds in
+	if !parsed.Segments[0].DateTimeObject.Equal(start.Add(6 * time.Second)) {
+		t.Errorf("got program date time %v, want %v", parsed.Segments[0].DateTimeObject, start.Add(6*time.Second))
+	}
+
+	ids := []string{}
+	for _, dateRange := range parsed.DateRanges {
+		ids = append(ids, dateRange.ID)
+	}
+	if fmt.Sprint(ids) != "[open second]" {
+		t.Errorf("got date ranges %v, want [open second]", ids)
+	}
+}
+
+func TestDateRangeWithoutProgramDateTime(t *testing.T) {
+	w := NewLiveWindow(3, 0)
+	w.TargetDuration(2)
+	w.DateRange(&parser.DateRange{ID: "ad", StartDate: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)})
+	for i := 1; i <= 6; i++ {
+		w.Segment(fmt.Sprintf("segment%d.ts", i), 2)
+	}
+
+	if _, err := w.Build(); err == nil {
+		t.Error("no error for a date range without program date time")
+	}
+}
@@ -0,0 +1,335 @@
+// Package builder creates playlists programmatically, keeping the
+// bookkeeping of the resulting manifests consistent
+package builder
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parsestream"
+)
+
+// DefaultVersion is the lowest protocol version of playlists that do not
+// set one, the first version that allows fractional segment durations
+const DefaultVersion = 3
+
+// MediaPlaylist builds a media playlist segment by segment. Keys,
+// initialization segments, discontinuities and program date times apply to
+// the segments appended after them, as in a playlist. The first error is
+// reported by Build.
+type MediaPlaylist struct {
+	manifest *parser.Manifest
+	// version is the protocol version set by Version, or 0 to derive it
+	// from the features used
+	version int
+	// targetDuration is the fixed target duration, or 0 to derive it from
+	// the segment durations
+	targetDuration int
+	// longest is the longest segment duration appended so far, rounded to
+	// the nearest integer
+	longest int
+	// maxSegments and maxDuration limit the segments kept by a LiveWindow
+	maxSegments int
+	maxDuration float64
+
+	keys          []*parser.Key
+	initMap       *parser.Map
+	discontinuity bool
+	timeline      int
+	// dateTime is the explicit program date time of the next segment and
+	// nextDateTime the extrapolated one
+	dateTime     time.Time
+	nextDateTime time.Time
+
+	err error
+}
+
+// NewMediaPlaylist creates a builder for an empty media playlist
+func NewMediaPlaylist() *MediaPlaylist {
+	return &MediaPlaylist{
+		manifest: &parser.Manifest{
+			AllowCache:          true,
+			Version:             DefaultVersion,
+			Segments:            []*parser.Segment{},
+			DiscontinuityStarts: []int{},
+			DateRanges:          []*parser.DateRange{},
+			IFramePlaylists:     []*parser.IFramePlaylist{},
+		},
+	}
+}
+
+// fail records an error unless one has already occurred
+func (b *MediaPlaylist) fail(format string, args ...interface{}) {
+	if b.err == nil {
+		b.err = fmt.Errorf("builder: "+format, args...)
+	}
+}
+
+// Version sets the protocol version. Without it the playlist has the
+// DefaultVersion or the minimum version its features require.
+func (b *MediaPlaylist) Version(version int) *MediaPlaylist {
+	b.manifest.Version = version
+	b.version = version
+	return b
+}
+
+// TargetDuration fixes the target duration. Without it the target duration
+// is the longest segment duration rounded to the nearest integer.
+func (b *MediaPlaylist) TargetDuration(seconds int) *MediaPlaylist {
+	if seconds <= 0 {
+		b.fail("invalid target duration %d", seconds)
+		return b
+	}
+	b.targetDuration = seconds
+	for _, segment := range b.manifest.Segments {
+		b.checkDuration(segment)
+	}
+	return b
+}
+
+// MediaSequence sets the media sequence number of the first segment
+func (b *MediaPlaylist) MediaSequence(number int) *MediaPlaylist {
+	if number < 0 {
+		b.fail("invalid media sequence number %d", number)
+		return b
+	}
+	b.manifest.MediaSequence = number
+	return b
+}
+
+// DiscontinuitySequence sets the discontinuity sequence number of the first
+// segment. It must be set before segments are appended.
+func (b *MediaPlaylist) DiscontinuitySequence(number int) *MediaPlaylist {
+	if number < 0 {
+		b.fail("invalid discontinuity sequence number %d", number)
+		return b
+	}
+	if len(b.manifest.Segments) > 0 {
+		b.fail("discontinuity sequence must be set before the first segment")
+		return b
+	}
+	b.manifest.DiscontinuitySequence = number
+	b.timeline = number
+	return b
+}
+
+// PlaylistType sets the playlist type, either EVENT or VOD
+func (b *MediaPlaylist) PlaylistType(playlistType string) *MediaPlaylist {
+	if playlistType != "EVENT" && playlistType != "VOD" {
+		b.fail("invalid playlist type %q", playlistType)
+		return b
+	}
+	b.manifest.PlaylistType = playlistType
+	return b
+}
+
+// IndependentSegments declares that all media samples of a segment can be
+// decoded without information from other segments
+func (b *MediaPlaylist) IndependentSegments() *MediaPlaylist {
+	b.manifest.IndependentSegments = true
+	return b
+}
+
+// Key encrypts the following segments with key, replacing the active key of
+// the same KEYFORMAT. A key with METHOD=NONE removes all active keys.
+func (b *MediaPlaylist) Key(key *parser.Key) *MediaPlaylist {
+	if key == nil {
+		b.fail("no key")
+		return b
+	}
+	if key.Method == parser.MethodNone {
+		b.keys = nil
+		return b
+	}
+	if err := key.Validate(); err != nil {
+		b.fail("key %v", err)
+		return b
+	}
+
+	if key.KeyFormat == "" {
+		normalized := *key
+		normalized.KeyFormat = parser.DefaultKeyFormat
+		key = &normalized
+	}
+
+	keys := make([]*parser.Key, 0, len(b.keys)+1)
+	replaced := false
+	for _, active := range b.keys {
+		if active.KeyFormat == key.KeyFormat {
+			keys = append(keys, key)
+			replaced = true
+		} else {
+			keys = append(keys, active)
+		}
+	}
+	if !replaced {
+		keys = append(keys, key)
+	}
+	b.keys = keys
+	return b
+}
+
+// Map sets the initialization segment of the following segments. byterange
+// may be nil if the initialization segment is the whole resource.
+func (b *MediaPlaylist) Map(uri string, byterange *parsestream.Byterange) *MediaPlaylist {
+	if uri == "" {
+		b.fail("initialization segment without URI")
+		return b
+	}
+	b.initMap = &parser.Map{
+		URI:       uri,
+		Byterange: byterange,
+	}
+	if b.keys != nil {
+		b.initMap.Keys = b.keys
+		b.initMap.Key = b.keys[0]
+	}
+	return b
+}
+
+// Discontinuity marks a discontinuity before the next segment
+func (b *MediaPlaylist) Discontinuity() *MediaPlaylist {
+	b.discontinuity = true
+	return b
+}
+
+// ProgramDateTime sets the date and time of the first sample of the next
+// segment. The date time of later segments is extrapolated from it.
+func (b *MediaPlaylist) ProgramDateTime(dateTime time.Time) *MediaPlaylist {
+	b.dateTime = dateTime
+	return b
+}
+
+// Segment appends a segment with the given URI and duration in seconds
+func (b *MediaPlaylist) Segment(uri string, duration float64) *MediaPlaylist {
+	return b.AddSegment(&parser.Segment{
+		URI:      uri,
+		Duration: duration,
+	})
+}
+
+// AddSegment appends a copy of a segment that may carry further information
+// such as a title or byterange; the segment itself is left unchanged. Keys,
+// the initialization segment and the program date time are only taken from
+// the builder if the segment does not set them.
+func (b *MediaPlaylist) AddSegment(segment *parser.Segment) *MediaPlaylist {
+	if segment == nil || segment.URI == "" {
+		b.fail("segment %d has no URI", len(b.manifest.Segments))
+		return b
+	}
+	if segment.Duration < 0 || math.IsNaN(segment.Duration) || math.IsInf(segment.Duration, 0) {
+		b.fail("segment %s has invalid duration %g", segment.URI, segment.Duration)
+		return b
+	}
+
+	copied := *segment
+	segment = &copied
+
+	if segment.Keys == nil && b.keys != nil {
+		segment.Keys = b.keys
+	}
+	if len(segment.Keys) > 0 {
+		segment.Key = segment.Keys[0]
+	}
+	if segment.Map == nil {
+		segment.Map = b.initMap
+	}
+
+	if b.discontinuity || segment.Discontinuity {
+		segment.Discontinuity = true
+		b.timeline++
+		b.manifest.DiscontinuityStarts = append(b.manifest.DiscontinuityStarts, len(b.manifest.Segments))
+	}
+	segment.Timeline = b.timeline
+	b.discontinuity = false
+
+	if segment.DateTimeObject.IsZero() && !b.dateTime.IsZero() {
+		segment.DateTimeObject = b.dateTime
+	}
+	b.dateTime = time.Time{}
+	if !segment.DateTimeObject.IsZero() {
+		b.nextDateTime = segment.DateTimeObject
+		if b.manifest.DateTimeObject.IsZero() {
+			b.manifest.DateTimeObject = segment.DateTimeObject
+		}
+	}
+	if !b.nextDateTime.IsZero() {
+		segment.ProgramDateTime = b.nextDateTime.UnixNano() / int64(time.Millisecond)
+		b.nextDateTime = b.nextDateTime.Add(time.Duration(segment.Duration * float64(time.Second)))
+	}
+
+	b.checkDuration(segment)
+	if duration := int(math.Round(segment.Duration)); duration > b.longest {
+		b.longest = duration
+	}
+	b.manifest.Segments = append(b.manifest.Segments, segment)
+	b.evict()
+	return b
+}
+
+// DateRange adds a date range to the playlist. A playlist with date ranges
+// must contain a program date time, which is also needed to remove the date
+// ranges that ended from a LiveWindow; Build fails otherwise.
+func (b *MediaPlaylist) DateRange(dateRange *parser.DateRange) *MediaPlaylist {
+	if dateRange == nil || dateRange.ID == "" {
+		b.fail("date range without ID")
+		return b
+	}
+	if dateRange.StartDate.IsZero() {
+		b.fail("date range %s without START-DATE", dateRange.ID)
+		return b
+	}
+	b.manifest.DateRanges = append(b.manifest.DateRanges, dateRange)
+	return b
+}
+
+// minimumVersion returns the DefaultVersion or the minimum version the
+// features of the manifest require if that is higher
+func minimumVersion(manifest *parser.Manifest) int {
+	if version := manifest.MinimumVersion(); version > DefaultVersion {
+		return version
+	}
+	return DefaultVersion
+}
+
+// checkDuration reports a segment that is longer than the fixed target duration
+func (b *MediaPlaylist) checkDuration(segment *parser.Segment) {
+	if b.targetDuration > 0 && int(math.Round(segment.Duration)) > b.targetDuration {
+		b.fail("segment %s duration %g exceeds target duration %d", segment.URI, segment.Duration, b.targetDuration)
+	}
+}
+
+// EndList declares that no more segments will be added
+func (b *MediaPlaylist) EndList() *MediaPlaylist {
+	b.manifest.EndList = true
+	return b
+}
+
+// Build returns the manifest of the playlist built so far. The builder can be
+// used to append further segments afterwards without affecting the manifest.
+func (b *MediaPlaylist) Build() (*parser.Manifest, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(b.manifest.DateRanges) > 0 && b.manifest.DateTimeObject.IsZero() {
+		return nil, fmt.Errorf("builder: date range %s without program date time", b.manifest.DateRanges[0].ID)
+	}
+
+	manifest := *b.manifest
+	manifest.Segments = append([]*parser.Segment{}, b.manifest.Segments...)
+	manifest.DiscontinuityStarts = append([]int{}, b.manifest.DiscontinuityStarts...)
+	manifest.DateRanges = append([]*parser.DateRange{}, b.manifest.DateRanges...)
+
+	// the target duration must not decrease when segments are removed
+	manifest.TargetDuration = b.targetDuration
+	if manifest.TargetDuration == 0 {
+		manifest.TargetDuration = b.longest
+	}
+	if b.version == 0 {
+		manifest.Version = minimumVersion(&manifest)
+	}
+
+	return &manifest, nil
+}
@@ -0,0 +1,93 @@
+package builder
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+	"github.com/ar13101085/go-m3u8-parser/m3u8/validate"
+)
+
+// roundTrip marshals a built manifest, reports the errors the validator finds
+// in the playlist and returns the manifest parsed from it
+func roundTrip(t *testing.T, manifest *parser.Manifest) *parser.Manifest {
+	t.Helper()
+
+	output, err := manifest.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, finding := range validate.ValidateString(string(output)) {
+		if finding.Severity == validate.Error {
+			t.Errorf("%s\n%s", finding, output)
+		}
+	}
+
+	parsed, err := parser.Parse(context.Background(), strings.NewReader(string(output)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestAddSegment(t *testing.T) {
+	key := &parser.Key{Method: parser.MethodAES128, URI: "key.bin"}
+	dateTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	segment := &parser.Segment{URI: "segment1.ts", Duration: 4, Title: "first"}
+	original := *segment
+
+	b := NewMediaPlaylist().
+		Key(key).
+		ProgramDateTime(dateTime).
+		Discontinuity().
+		AddSegment(segment).
+		AddSegment(&parser.Segment{URI: "segment2.ts", Duration: 0}).
+		EndList()
+
+	manifest, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if segment.Keys != nil || segment.Key != nil || segment.Discontinuity ||
+		segment.Timeline != original.Timeline || !segment.DateTimeObject.IsZero() || segment.ProgramDateTime != 0 {
+		t.Errorf("the segment passed to AddSegment was modified: %+v", segment)
+	}
+	if manifest.Segments[0] == segment {
+		t.Error("the manifest holds the segment passed to AddSegment instead of a copy")
+	}
+
+	parsed := roundTrip(t, manifest)
+	if len(parsed.Segments) != 2 {
+		t.Fatalf("got %d segments, want 2", len(parsed.Segments))
+	}
+	first := parsed.Segments[0]
+	if first.Title != "first" || first.Key == nil || first.Key.URI != "key.bin" ||
+		!first.Discontinuity || !first.DateTimeObject.Equal(dateTime) {
+		t.Errorf("got first segment %+v", first)
+	}
+	// the parser replaces a duration of zero by a small value
+	if parsed.Segments[1].Duration <= 0 || parsed.Segments[1].Duration > 0.1 {
+		t.Errorf("got duration %g, want a duration of zero", parsed.Segments[1].Duration)
+	}
+}
+
+func TestAddSegmentInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		segment *parser.Segment
+	}{
+		{"nil", nil},
+		{"no URI", &parser.Segment{Duration: 4}},
+		{"negative duration", &parser.Segment{URI: "segment.ts", Duration: -1}},
+	}
+
+	for _, test := range tests {
+		if _, err := NewMediaPlaylist().AddSegment(test.segment).Build(); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package builder
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+// Rendition is an alternative rendition declared by #EXT-X-MEDIA
+type Rendition struct {
+	// Type is AUDIO, VIDEO, SUBTITLES or CLOSED-CAPTIONS
+	Type            string
+	GroupID         string
+	Name            string
+	Language        string
+	URI             string
+	Default         bool
+	Autoselect      bool
+	Forced          bool
+	InstreamID      string
+	Characteristics string
+
+	// Codecs, Bandwidth and AverageBandwidth describe the media of the
+	// rendition. They are not written to the playlist but added to the
+	// variant streams that use the group of the rendition.
+	Codecs           []string
+	Bandwidth        int
+	AverageBandwidth int
+}
+
+// Variant is a variant stream declared by #EXT-X-STREAM-INF or an i-frame
+// playlist declared by #EXT-X-I-FRAME-STREAM-INF
+type Variant struct {
+	URI              string
+	Bandwidth        int
+	AverageBandwidth int
+	// Codecs are the codecs of the variant stream itself, without those of
+	// the renditions it uses
+	Codecs     []string
+	Width      int
+	Height     int
+	FrameRate  float64
+	HDCPLevel  string
+	VideoRange string
+
+	// Audio, Video, Subtitles and ClosedCaptions are the GROUP-IDs of the
+	// renditions used by the variant stream. ClosedCaptions may be NONE.
+	Audio          string
+	Video          string
+	Subtitles      string
+	ClosedCaptions string
+
+	// Attributes are further attributes such as PATHWAY-ID, written as they are
+	Attributes map[string]string
+}
+
+// instreamIDPattern matches the valid INSTREAM-ID values
+var instreamIDPattern = regexp.MustCompile(`^(CC[1-4]|SERVICE([1-9]|[1-5][0-9]|6[0-3]))$`)
+
+// groupMedia is the media of the renditions of a group
+type groupMedia struct {
+	codecs           []string
+	bandwidth        int
+	averageBandwidth int
+}
+
+// MultivariantPlaylist builds a multivariant playlist from variant streams,
+// i-frame playlists and renditions. Build checks that every group used by a
+// variant stream exists, adds the codecs and bandwidth of the renditions to
+// the variant streams and orders them by BANDWIDTH. The first error is
+// reported by Build.
+type MultivariantPlaylist struct {
+	manifest *parser.Manifest
+	// version is the protocol version set by Version, or 0 to derive it
+	// from the features used
+	version  int
+	variants []Variant
+	iFrames  []Variant
+	// media holds the media of the renditions by type and GROUP-ID
+	media map[string]map[string]*groupMedia
+
+	err error
+}
+
+// NewMultivariantPlaylist creates a builder for an empty multivariant playlist
+func NewMultivariantPlaylist() *MultivariantPlaylist {
+	b := &MultivariantPlaylist{
+		manifest: &parser.Manifest{
+			AllowCache:      true,
+			Version:         DefaultVersion,
+			Segments:        []*parser.Segment{},
+			IFramePlaylists: []*parser.IFramePlaylist{},
+			MediaGroups:     make(map[string]map[string]map[string]*parser.MediaGroup),
+		},
+		media: make(map[string]map[string]*groupMedia),
+	}
+	for _, mediaType := range []string{"AUDIO", "VIDEO", "CLOSED-CAPTIONS", "SUBTITLES"} {
+		b.manifest.MediaGroups[mediaType] = make(map[string]map[string]*parser.MediaGroup)
+		b.media[mediaType] = make(map[string]*groupMedia)
+	}
+	return b
+}
+
+// fail records an error unless one has already occurred
+func (b *MultivariantPlaylist) fail(format string, args ...interface{}) {
+	if b.err == nil {
+		b.err = fmt.Errorf("builder: "+format, args...)
+	}
+}
+
+// Version sets the protocol version. Without it the playlist has the
+// DefaultVersion or the minimum version its features require.
+func (b *MultivariantPlaylist) Version(version int) *MultivariantPlaylist {
+	b.manifest.Version = version
+	b.version = version
+	return b
+}
+
+// IndependentSegments declares that all media samples of the segments of
+// every media playlist can be decoded without information from other segments
+func (b *MultivariantPlaylist) IndependentSegments() *MultivariantPlaylist {
+	b.manifest.IndependentSegments = true
+	return b
+}
+
+// Rendition adds an alternative rendition to its group. A group has at most
+// one default rendition, and a default rendition is always selected
+// automatically.
+func (b *MultivariantPlaylist) Rendition(rendition Rendition) *MultivariantPlaylist {
+	groups, ok := b.manifest.MediaGroups[rendition.Type]
+	if !ok {
+		b.fail("rendition %q has invalid TYPE %q", rendition.Name, rendition.Type)
+		return b
+	}
+	if rendition.GroupID == "" {
+		b.fail("%s rendition %q without GROUP-ID", rendition.Type, rendition.Name)
+		return b
+	}
+	if rendition.Name == "" {
+		b.fail("%s rendition in group %q without NAME", rendition.Type, rendition.GroupID)
+		return b
+	}
+
+	switch {
+	case rendition.Type == "CLOSED-CAPTIONS" && rendition.URI != "":
+		b.fail("CLOSED-CAPTIONS rendition %q must not have a URI", rendition.Name)
+		return b
+	case rendition.Type == "CLOSED-CAPTIONS" && !instreamIDPattern.MatchString(rendition.InstreamID):
+		b.fail("CLOSED-CAPTIONS rendition %q has invalid INSTREAM-ID %q", rendition.Name, rendition.InstreamID)
+		return b
+	case rendition.Type != "CLOSED-CAPTIONS" && rendition.InstreamID != "":
+		b.fail("%s rendition %q must not have an INSTREAM-ID", rendition.Type, rendition.Name)
+		return b
+	case rendition.Type == "SUBTITLES" && rendition.URI == "":
+		b.fail("SUBTITLES rendition %q without URI", rendition.Name)
+		return b
+	case rendition.Type != "SUBTITLES" && rendition.Forced:
+		b.fail("%s rendition %q must not be forced", rendition.Type, rendition.Name)
+		return b
+	}
+
+	group := groups[rendition.GroupID]
+	if group == nil {
+		group = make(map[string]*parser.MediaGroup)
+		groups[rendition.GroupID] = group
+		b.media[rendition.Type][rendition.GroupID] = &groupMedia{}
+	}
+	if _, ok := group[rendition.Name]; ok {
+		b.fail("%s group %q has two renditions named %q", rendition.Type, rendition.GroupID, rendition.Name)
+		return b
+	}
+	if rendition.Default {
+		for name, other := range group {
+			if other.Default {
+				b.fail("%s group %q has two default renditions, %q and %q",
+					rendition.Type, rendition.GroupID, name, rendition.Name)
+				return b
+			}
+		}
+	}
+
+	group[rendition.Name] = &parser.MediaGroup{
+		Default:         rendition.Default,
+		Autoselect:      rendition.Autoselect || rendition.Default,
+		Language:        rendition.Language,
+		URI:             rendition.URI,
+		InstreamID:      rendition.InstreamID,
+		Characteristics: rendition.Characteristics,
+		Forced:          rendition.Forced,
+	}
+
+	media := b.media[rendition.Type][rendition.GroupID]
+	media.codecs = appendCodecs(media.codecs, rendition.Codecs)
+	if rendition.Bandwidth > media.bandwidth {
+		media.bandwidth = rendition.Bandwidth
+	}
+	if rendition.AverageBandwidth > media.averageBandwidth {
+		media.averageBandwidth = rendition.AverageBandwidth
+	}
+	return b
+}
+
+// Variant adds a variant stream. Its BANDWIDTH and AVERAGE-BANDWIDTH are
+// increased by the largest ones of the renditions in each group it uses, and
+// the codecs of these renditions are added to its CODECS.
+func (b *MultivariantPlaylist) Variant(variant Variant) *MultivariantPlaylist {
+	if b.checkVariant("variant stream", variant) {
+		b.variants = append(b.variants, variant)
+	}
+	return b
+}
+
+// IFrameVariant adds an i-frame playlist. It may use a VIDEO group, but has
+// no frame rate, audio, subtitles or closed captions.
+func (b *MultivariantPlaylist) IFrameVariant(variant Variant) *MultivariantPlaylist {
+	if !b.checkVariant("i-frame playlist", variant) {
+		return b
+	}
+	if variant.FrameRate != 0 || variant.Audio != "" || variant.Subtitles != "" || variant.ClosedCaptions != "" {
+		b.fail("i-frame playlist %s must not have FRAME-RATE, AUDIO, SUBTITLES or CLOSED-CAPTIONS", variant.URI)
+		return b
+	}
+	b.iFrames = append(b.iFrames, variant)
+	return b
+}
+
+// checkVariant reports whether a variant stream or i-frame playlist is valid
+func (b *MultivariantPlaylist) checkVariant(kind string, variant Variant) bool {
+	if variant.URI == "" {
+		b.fail("%s %d has no URI", kind, len(b.variants)+len(b.iFrames))
+		return false
+	}
+	if variant.Bandwidth <= 0 {
+		b.fail("%s %s has invalid BANDWIDTH %d", kind, variant.URI, variant.Bandwidth)
+		return false
+	}
+	if variant.AverageBandwidth < 0 || variant.Width < 0 || variant.Height < 0 || variant.FrameRate < 0 {
+		b.fail("%s %s has negative attributes", kind, variant.URI)
+		return false
+	}
+	if (variant.Width == 0) != (variant.Height == 0) {
+		b.fail("%s %s has incomplete RESOLUTION %dx%d", kind, variant.URI, variant.Width, variant.Height)
+		return false
+	}
+	return true
+}
+
+// Build returns the multivariant playlist built so far. The builder can be
+// used to add further variant streams afterwards without affecting the
+// manifest.
+func (b *MultivariantPlaylist) Build() (*parser.Manifest, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	manifest := *b.manifest
+	manifest.MediaGroups = make(map[string]map[string]map[string]*parser.MediaGroup)
+	for mediaType, groups := range b.manifest.MediaGroups {
+		manifest.MediaGroups[mediaType] = make(map[string]map[string]*parser.MediaGroup)
+		for groupID, group := range groups {
+			manifest.MediaGroups[mediaType][groupID] = make(map[string]*parser.MediaGroup)
+			for name, rendition := range group {
+				copied := *rendition
+				manifest.MediaGroups[mediaType][groupID][name] = &copied
+			}
+		}
+	}
+
+	// all variant streams either have closed captions or declare that they
+	// have none
+	noClosedCaptions := 0
+	for _, variant := range b.variants {
+		if variant.ClosedCaptions == "NONE" {
+			noClosedCaptions++
+		}
+	}
+	if noClosedCaptions > 0 && noClosedCaptions < len(b.variants) {
+		return nil, fmt.Errorf("builder: CLOSED-CAPTIONS=NONE must be set on all variant streams or none")
+	}
+
+	manifest.Playlists = make([]*parser.Variant, 0, len(b.variants))
+	for _, variant := range b.sorted(b.variants) {
+		attributes, err := b.attributes(variant)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Playlists = append(manifest.Playlists, parser.NewVariant(variant.URI, attributes))
+	}
+
+	manifest.IFramePlaylists = make([]*parser.IFramePlaylist, 0, len(b.iFrames))
+	for _, variant := range b.sorted(b.iFrames) {
+		attributes, err := b.attributes(variant)
+		if err != nil {
+			return nil, err
+		}
+		attributes["URI"] = variant.URI
+		manifest.IFramePlaylists = append(manifest.IFramePlaylists, &parser.IFramePlaylist{
+			Variant: *parser.NewVariant(variant.URI, attributes),
+		})
+	}
+
+	if b.version == 0 {
+		manifest.Version = minimumVersion(&manifest)
+	}
+	return &manifest, nil
+}
+
+// sorted returns the variants ordered by their BANDWIDTH including the
+// renditions they use, keeping the order of variants with the same BANDWIDTH
+func (b *MultivariantPlaylist) sorted(variants []Variant) []Variant {
+	sorted := append([]Variant{}, variants...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return b.bandwidth(sorted[i]) < b.bandwidth(sorted[j])
+	})
+	return sorted
+}
+
+// groups returns the media of the groups used by a variant, or an error if
+// one of them does not exist
+func (b *MultivariantPlaylist) groups(variant Variant) ([]*groupMedia, error) {
+	used := []struct{ mediaType, groupID string }{
+		{"AUDIO", variant.Audio},
+		{"VIDEO", variant.Video},
+		{"SUBTITLES", variant.Subtitles},
+		{"CLOSED-CAPTIONS", variant.ClosedCaptions},
+	}
+
+	groups := []*groupMedia{}
+	for _, group := range used {
+		if group.groupID == "" || (group.mediaType == "CLOSED-CAPTIONS" && group.groupID == "NONE") {
+			continue
+		}
+		media, ok := b.media[group.mediaType][group.groupID]
+		if !ok {
+			return nil, fmt.Errorf("builder: variant %s uses %s group %q, which has no renditions",
+				variant.URI, group.mediaType, group.groupID)
+		}
+		groups = append(groups, media)
+	}
+	return groups, nil
+}
+
+// bandwidth returns the BANDWIDTH of a variant including the renditions it uses
+func (b *MultivariantPlaylist) bandwidth(variant Variant) int {
+	bandwidth := variant.Bandwidth
+	groups, _ := b.groups(variant)
+	for _, media := range groups {
+		bandwidth += media.bandwidth
+	}
+	return bandwidth
+}
+
+// attributes returns the attributes of a variant stream or i-frame playlist
+// as parsestream reports them
+func (b *MultivariantPlaylist) attributes(variant Variant) (map[string]string, error) {
+	groups, err := b.groups(variant)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := make(map[string]string)
+	for name, value := range variant.Attributes {
+		attributes[name] = value
+	}
+
+	bandwidth := variant.Bandwidth
+	averageBandwidth := variant.AverageBandwidth
+	codecs := appendCodecs(nil, variant.Codecs)
+	for _, media := range groups {
+		bandwidth += media.bandwidth
+		if averageBandwidth > 0 {
+			averageBandwidth += media.averageBandwidth
+		}
+		codecs = appendCodecs(codecs, media.codecs)
+	}
+
+	attributes["BANDWIDTH"] = strconv.Itoa(bandwidth)
+	if averageBandwidth > 0 {
+		attributes["AVERAGE-BANDWIDTH"] = strconv.Itoa(averageBandwidth)
+	}
+	if len(codecs) > 0 {
+		attributes["CODECS"] = strings.Join(codecs, ",")
+	}
+	if variant.Width > 0 {
+		attributes["RESOLUTION"] = fmt.Sprintf("%dx%d", variant.Width, variant.Height)
+	}
+	if variant.FrameRate > 0 {
+		attributes["FRAME-RATE"] = strconv.FormatFloat(math.Round(variant.FrameRate*1000)/1000, 'f', -1, 64)
+	}
+	if variant.HDCPLevel != "" {
+		attributes["HDCP-LEVEL"] = variant.HDCPLevel
+	}
+	if variant.VideoRange != "" {
+		attributes["VIDEO-RANGE"] = variant.VideoRange
+	}
+
+	used := map[string]string{
+		"AUDIO":           variant.Audio,
+		"VIDEO":           variant.Video,
+		"SUBTITLES":       variant.Subtitles,
+		"CLOSED-CAPTIONS": variant.ClosedCaptions,
+	}
+	for name, groupID := range used {
+		if groupID != "" {
+			attributes[name] = groupID
+		}
+	}
+	return attributes, nil
+}
+
+// appendCodecs appends the codecs that are not yet in the list
+func appendCodecs(list []string, codecs []string) []string {
+	for _, codec := range codecs {
+		found := false
+		for _, existing := range list {
+			if existing == codec {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, codec)
+		}
+	}
+	return list
+}
@@ -0,0 +1,150 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMultivariantPlaylist(t *testing.T) {
+	b := NewMultivariantPlaylist().
+		IndependentSegments().
+		Rendition(Rendition{
+			Type: "AUDIO", GroupID: "aac", Name: "English", Language: "en", URI: "audio/en.m3u8",
+			Default: true, Codecs: []string{"mp4a.40.2"}, Bandwidth: 128000, AverageBandwidth: 96000,
+		}).
+		Rendition(Rendition{
+			Type: "AUDIO", GroupID: "aac", Name: "German", Language: "de", URI: "audio/de.m3u8",
+			Codecs: []string{"mp4a.40.2"}, Bandwidth: 64000, AverageBandwidth: 48000,
+		}).
+		Rendition(Rendition{
+			Type: "SUBTITLES", GroupID: "subs", Name: "English", Language: "en", URI: "subs/en.m3u8",
+			Codecs: []string{"wvtt"},
+		}).
+		Variant(Variant{
+			URI: "high.m3u8", Bandwidth: 5000000, AverageBandwidth: 4000000, Codecs: []string{"avc1.640028"},
+			Width: 1920, Height: 1080, FrameRate: 29.97, Audio: "aac", Subtitles: "subs",
+		}).
+		Variant(Variant{
+			URI: "low.m3u8", Bandwidth: 800000, Codecs: []string{"avc1.4d401e"},
+			Width: 640, Height: 360, Audio: "aac", Subtitles: "subs",
+		}).
+		IFrameVariant(Variant{URI: "iframe.m3u8", Bandwidth: 200000, Codecs: []string{"avc1.4d401e"}, Width: 640, Height: 360})
+
+	manifest, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := roundTrip(t, manifest)
+
+	if len(parsed.Playlists) != 2 {
+		t.Fatalf("got %d variant streams, want 2", len(parsed.Playlists))
+	}
+
+	// the variant streams are ordered by BANDWIDTH including the largest
+	// BANDWIDTH of the audio renditions
+	tests := []struct {
+		uri              string
+		bandwidth        int
+		averageBandwidth int
+		codecs           string
+	}{
+		{"low.m3u8", 928000, 0, "avc1.4d401e,mp4a.40.2,wvtt"},
+		{"high.m3u8", 5128000, 4096000, "avc1.640028,mp4a.40.2,wvtt"},
+	}
+	for i, test := range tests {
+		variant := parsed.Playlists[i]
+		if variant.URI != test.uri || variant.Bandwidth != test.bandwidth ||
+			variant.AverageBandwidth != test.averageBandwidth || strings.Join(variant.Codecs, ",") != test.codecs {
+			t.Errorf("variant stream %d: got %s BANDWIDTH=%d AVERAGE-BANDWIDTH=%d CODECS=%q, want %s BANDWIDTH=%d AVERAGE-BANDWIDTH=%d CODECS=%q",
+				i, variant.URI, variant.Bandwidth, variant.AverageBandwidth, variant.Codecs,
+				test.uri, test.bandwidth, test.averageBandwidth, test.codecs)
+		}
+	}
+
+	english := parsed.MediaGroups["AUDIO"]["aac"]["English"]
+	if english == nil || !english.Default || !english.Autoselect {
+		t.Errorf("got English rendition %+v, want a default rendition that is selected automatically", english)
+	}
+	if len(parsed.IFramePlaylists) != 1 || parsed.IFramePlaylists[0].URI != "iframe.m3u8" {
+		t.Errorf("got i-frame playlists %+v", parsed.IFramePlaylists)
+	}
+	if !parsed.IndependentSegments {
+		t.Error("#EXT-X-INDEPENDENT-SEGMENTS was not written")
+	}
+}
+
+func TestMultivariantPlaylistInvalid(t *testing.T) {
+	audio := Rendition{Type: "AUDIO", GroupID: "aac", Name: "English", URI: "en.m3u8"}
+
+	tests := []struct {
+		name string
+		b    *MultivariantPlaylist
+	}{
+		{
+			"undefined audio group",
+			NewMultivariantPlaylist().
+				Variant(Variant{URI: "low.m3u8", Bandwidth: 800000, Audio: "aac"}),
+		},
+		{
+			"undefined group of an i-frame playlist",
+			NewMultivariantPlaylist().
+				IFrameVariant(Variant{URI: "iframe.m3u8", Bandwidth: 200000, Video: "video"}),
+		},
+		{
+			"group of another type",
+			NewMultivariantPlaylist().
+				Rendition(audio).
+				Variant(Variant{URI: "low.m3u8", Bandwidth: 800000, Subtitles: "aac"}),
+		},
+		{
+			"two default renditions",
+			NewMultivariantPlaylist().
+				Rendition(Rendition{Type: "AUDIO", GroupID: "aac", Name: "English", URI: "en.m3u8", Default: true}).
+				Rendition(Rendition{Type: "AUDIO", GroupID: "aac", Name: "German", URI: "de.m3u8", Default: true}),
+		},
+		{
+			"two renditions with the same name",
+			NewMultivariantPlaylist().
+				Rendition(audio).
+				Rendition(audio),
+		},
+		{
+			"CLOSED-CAPTIONS=NONE on some variant streams",
+			NewMultivariantPlaylist().
+				Variant(Variant{URI: "low.m3u8", Bandwidth: 800000, ClosedCaptions: "NONE"}).
+				Variant(Variant{URI: "high.m3u8", Bandwidth: 5000000}),
+		},
+		{
+			"variant stream without BANDWIDTH",
+			NewMultivariantPlaylist().
+				Variant(Variant{URI: "low.m3u8"}),
+		},
+	}
+
+	for _, test := range tests {
+		if _, err := test.b.Build(); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+}
+
+func TestMultivariantPlaylistDefaultInOtherGroup(t *testing.T) {
+	// every group may have a default rendition of its own
+	b := NewMultivariantPlaylist().
+		Rendition(Rendition{Type: "AUDIO", GroupID: "aac", Name: "English", URI: "aac/en.m3u8", Default: true}).
+		Rendition(Rendition{Type: "AUDIO", GroupID: "ec3", Name: "English", URI: "ec3/en.m3u8", Default: true}).
+		Variant(Variant{URI: "low.m3u8", Bandwidth: 800000, Audio: "aac"}).
+		Variant(Variant{URI: "high.m3u8", Bandwidth: 5000000, Audio: "ec3"})
+
+	manifest, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed := roundTrip(t, manifest)
+
+	for _, groupID := range []string{"aac", "ec3"} {
+		if rendition := parsed.MediaGroups["AUDIO"][groupID]["English"]; rendition == nil || !rendition.Default {
+			t.Errorf("group %s: got rendition %+v, want a default rendition", groupID, rendition)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package decrypt provides streaming decryption of segments encrypted
+// according to the keys of a parsed playlist
+package decrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+// readSize is the amount of ciphertext read from the source at a time
+const readSize = 32 * 1024
+
+var (
+	// ErrNotBlockAligned is returned when the ciphertext is not a multiple of the AES block size
+	ErrNotBlockAligned = errors.New("decrypt: ciphertext is not a multiple of the block size")
+	// ErrInvalidPadding is returned when the plaintext does not end with valid PKCS#7 padding
+	ErrInvalidPadding = errors.New("decrypt: invalid PKCS#7 padding")
+)
+
+// Reader decrypts AES-128-CBC encrypted data while it is read, holding back
+// only the last block until the end of the input to remove its padding
+type Reader struct {
+	src  io.Reader
+	mode cipher.BlockMode
+	buf  []byte
+	// in holds ciphertext that does not yet fill a complete block
+	in []byte
+	// out holds plaintext ready to be returned
+	out []byte
+	// held is the last decrypted block, which may contain padding
+	held []byte
+	err  error
+}
+
+// NewReader returns a Reader that decrypts body, which is encrypted with key
+// using keyBytes as the 16 byte AES key and iv as the initialization vector
+func NewReader(body io.Reader, key *parser.Key, keyBytes []byte, iv []byte) (*Reader, error) {
+	if key == nil {
+		return nil, fmt.Errorf("decrypt: no key")
+	}
+	if key.Method != parser.MethodAES128 {
+		return nil, fmt.Errorf("decrypt: unsupported METHOD %s", key.Method)
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("decrypt: IV must be %d bytes, got %d", aes.BlockSize, len(iv))
+	}
+
+	if len(keyBytes) != 16 {
+		return nil, fmt.Errorf("decrypt: AES-128 key must be 16 bytes, got %d", len(keyBytes))
+	}
+
+	block, err := aes.NewCipher(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	return &Reader{
+		src:  body,
+		mode: cipher.NewCBCDecrypter(block, iv),
+		buf:  make([]byte, readSize),
+	}, nil
+}
+
+// NewSegmentReader returns a Reader for a segment encrypted with its identity
+// key, deriving the IV from the key or from mediaSequence, the media sequence
+// number of the segment. An unencrypted segment is returned unchanged.
+func NewSegmentReader(body io.Reader, segment *parser.Segment, mediaSequence int, keyBytes []byte) (io.Reader, error) {
+	if len(segment.Keys) == 0 {
+		return body, nil
+	}
+
+	key, err := identityKey(segment.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	iv, err := segment.IV(mediaSequence)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	return NewReader(body, key, keyBytes, iv)
+}
+
+// NewMapReader returns a Reader for an initialization segment encrypted with
+// its identity key, which must have an explicit IV. An unencrypted
+// initialization segment is returned unchanged.
+func NewMapReader(body io.Reader, initSegment *parser.Map, keyBytes []byte) (io.Reader, error) {
+	if len(initSegment.Keys) == 0 {
+		return body, nil
+	}
+
+	key, err := identityKey(initSegment.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	iv, err := initSegment.IV()
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	return NewReader(body, key, keyBytes, iv)
+}
+
+// identityKey returns the key of DefaultKeyFormat, whose key bytes are
+// loaded from its URI, among the keys of a multi-DRM playlist
+func identityKey(keys []*parser.Key) (*parser.Key, error) {
+	for _, key := range keys {
+		if key.KeyFormat == parser.DefaultKeyFormat {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("decrypt: no key with KEYFORMAT %s", parser.DefaultKeyFormat)
+}
+
+// Read reads decrypted data into p
+func (r *Reader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 && r.err == nil {
+		r.fill()
+	}
+
+	if len(r.out) > 0 {
+		n := copy(p, r.out)
+		r.out = r.out[n:]
+		return n, nil
+	}
+
+	return 0, r.err
+}
+
+// fill reads and decrypts the next chunk of ciphertext
+func (r *Reader) fill() {
+	n, err := r.src.Read(r.buf)
+	r.in = append(r.in, r.buf[:n]...)
+
+	if err != nil && err != io.EOF {
+		r.err = err
+		return
+	}
+
+	complete := len(r.in) - len(r.in)%aes.BlockSize
+	if complete > 0 {
+		plaintext := make([]byte, complete)
+		r.mode.CryptBlocks(plaintext, r.in[:complete])
+		r.in = r.in[complete:]
+
+		r.out = append(r.out, r.held...)
+		r.out = append(r.out, plaintext[:complete-aes.BlockSize]...)
+		r.held = plaintext[complete-aes.BlockSize:]
+	}
+
+	if err == io.EOF {
+		r.finish()
+	}
+}
+
+// finish removes the padding from the last block at the end of the input
+func (r *Reader) finish() {
+	if len(r.in) != 0 || len(r.held) == 0 {
+		r.err = ErrNotBlockAligned
+		return
+	}
+
+	padding := int(r.held[len(r.held)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		r.err = ErrInvalidPadding
+		return
+	}
+	for _, b := range r.held[len(r.held)-padding:] {
+		if int(b) != padding {
+			r.err = ErrInvalidPadding
+			return
+		}
+	}
+
+	r.out = append(r.out, r.held[:len(r.held)-padding]...)
+	r.held = nil
+	r.err = io.EOF
+}
@@ -0,0 +1,148 @@
+package decrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+var (
+	testKey = []byte("0123456789abcdef")
+	testIV  = []byte("fedcba9876543210")
+)
+
+// encryptAES128 pads plaintext with PKCS#7 and encrypts it with AES-128-CBC
+func encryptAES128(t *testing.T, plaintext, iv []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append(append([]byte{}, plaintext...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	return ciphertext
+}
+
+// pattern returns n bytes that differ from block to block
+func pattern(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	return data
+}
+
+func TestReader(t *testing.T) {
+	key := &parser.Key{Method: parser.MethodAES128, URI: "key.bin", KeyFormat: parser.DefaultKeyFormat}
+	sizes := []int{0, 1, 15, 16, 17, 31, 32, 33, readSize - 1, readSize, readSize + 1, 3*readSize + 5}
+	readers := map[string]func(io.Reader) io.Reader{
+		"whole":    func(r io.Reader) io.Reader { return r },
+		"one byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+		"data err": iotest.DataErrReader,
+	}
+
+	for _, size := range sizes {
+		plaintext := pattern(size)
+		ciphertext := encryptAES128(t, plaintext, testIV)
+		for name, wrap := range readers {
+			r, err := NewReader(wrap(bytes.NewReader(ciphertext)), key, testKey, testIV)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(iotest.OneByteReader(r))
+			if err != nil {
+				t.Errorf("%d bytes, %s reader: %v", size, name, err)
+				continue
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("%d bytes, %s reader: plaintext differs", size, name)
+			}
+		}
+	}
+}
+
+func TestReaderPadding(t *testing.T) {
+	key := &parser.Key{Method: parser.MethodAES128, URI: "key.bin", KeyFormat: parser.DefaultKeyFormat}
+	block, err := aes.NewCipher(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encrypt := func(plaintext []byte) []byte {
+		ciphertext := make([]byte, len(plaintext))
+		cipher.NewCBCEncrypter(block, testIV).CryptBlocks(ciphertext, plaintext)
+		return ciphertext
+	}
+
+	tests := []struct {
+		name       string
+		ciphertext []byte
+		want       error
+	}{
+		{"empty", nil, ErrNotBlockAligned},
+		{"partial block", encryptAES128(t, pattern(20), testIV)[:30], ErrNotBlockAligned},
+		{"zero padding", encrypt(append(pattern(15), 0)), ErrInvalidPadding},
+		{"padding too long", encrypt(append(pattern(15), 17)), ErrInvalidPadding},
+		{"inconsistent padding", encrypt(append(pattern(13), 1, 3, 3)), ErrInvalidPadding},
+	}
+
+	for _, test := range tests {
+		r, err := NewReader(bytes.NewReader(test.ciphertext), key, testKey, testIV)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(r); !errors.Is(err, test.want) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestNewSegmentReader(t *testing.T) {
+	p := parser.New()
+	p.Push(`#EXTM3U
+#EXT-X-VERSION:5
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:7
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="skd://key",KEYFORMAT="com.apple.streamingkeydelivery",KEYFORMATVERSIONS="1"
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin"
+#EXTINF:10,
+segment.ts
+#EXT-X-ENDLIST
+`)
+	if err := p.End(); err != nil {
+		t.Fatal(err)
+	}
+
+	// without an explicit IV the media sequence number is the IV
+	iv := make([]byte, aes.BlockSize)
+	iv[aes.BlockSize-1] = 7
+	plaintext := pattern(1000)
+	ciphertext := encryptAES128(t, plaintext, iv)
+
+	segment := p.Manifest.Segments[0]
+	r, err := NewSegmentReader(bytes.NewReader(ciphertext), segment, p.Manifest.SegmentMediaSequence(0), testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Error("plaintext differs")
+	}
+
+	segment.Keys = segment.Keys[:1]
+	if _, err := NewSegmentReader(bytes.NewReader(ciphertext), segment, 7, testKey); err == nil {
+		t.Error("expected an error for a segment without identity key")
+	}
+}
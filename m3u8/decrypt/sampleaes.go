@@ -0,0 +1,697 @@
+package decrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+// MPEG-TS constants
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+	patPID       = 0
+)
+
+// Stream types of SAMPLE-AES encrypted elementary streams and the stream
+// types of their decrypted counterparts
+var sampleAESStreamTypes = map[byte]byte{
+	0xdb: 0x1b, // H.264
+	0xcf: 0x0f, // AAC ADTS
+}
+
+// SAMPLE-AES H.264 encryption pattern: the first 32 bytes of a NAL unit are
+// clear, then one encrypted block is followed by up to nine clear blocks
+const (
+	h264ClearLeader  = 32
+	h264ClearSkip    = 9 * aes.BlockSize
+	h264MinNALLength = 48
+)
+
+// aacClearLeader is the number of clear bytes following the ADTS header
+const aacClearLeader = 16
+
+// DecryptSampleAESSegment decrypts a SAMPLE-AES encrypted MPEG-TS segment
+// with its identity key, deriving the IV from the key or from mediaSequence,
+// the media sequence number of the segment. An unencrypted segment is
+// returned unchanged.
+func DecryptSampleAESSegment(data []byte, segment *parser.Segment, mediaSequence int, keyBytes []byte) ([]byte, error) {
+	if len(segment.Keys) == 0 {
+		return data, nil
+	}
+
+	key, err := identityKey(segment.Keys)
+	if err != nil {
+		return nil, err
+	}
+
+	iv, err := segment.IV(mediaSequence)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	return DecryptSampleAESTransportStream(data, key, keyBytes, iv)
+}
+
+// DecryptSampleAESTransportStream decrypts the H.264 and AAC elementary
+// streams of a SAMPLE-AES encrypted MPEG-TS segment. The PES packets are
+// repacketized where their size changes and the PMT is updated to announce
+// the clear stream types. Packets keep their position relative to the
+// packets of other PIDs.
+func DecryptSampleAESTransportStream(data []byte, key *parser.Key, keyBytes []byte, iv []byte) ([]byte, error) {
+	if key == nil {
+		return nil, fmt.Errorf("decrypt: no key")
+	}
+	if key.Method == parser.MethodSampleAESCTR {
+		return nil, fmt.Errorf("decrypt: METHOD %s is only used with fragmented MP4 segments", key.Method)
+	}
+	if key.Method != parser.MethodSampleAES {
+		return nil, fmt.Errorf("decrypt: unsupported METHOD %s", key.Method)
+	}
+
+	sample, err := newSampleCipher(keyBytes, iv)
+	if err != nil {
+		return nil, err
+	}
+
+	packets, err := splitPackets(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// find the PMT sections, which may span several packets, and the
+	// encrypted elementary streams
+	pmtPIDs := make(map[int]bool)
+	streamTypes := make(map[int]byte)
+	pmtSections := [][]int{}
+	incomplete := make(map[int][]int)
+	for i, packet := range packets {
+		pid := packetPID(packet)
+		if !packetHasPayload(packet) {
+			continue
+		}
+
+		if pid == patPID && payloadUnitStart(packet) {
+			for _, pmtPID := range parsePAT(packetPayload(packet)) {
+				pmtPIDs[pmtPID] = true
+			}
+			continue
+		}
+		if !pmtPIDs[pid] {
+			continue
+		}
+
+		indices, ok := incomplete[pid]
+		if payloadUnitStart(packet) {
+			indices = nil
+		} else if !ok {
+			continue
+		}
+		indices = append(indices, i)
+
+		payload := joinPayloads(packetsAt(packets, indices))
+		if !sectionComplete(payload) {
+			incomplete[pid] = indices
+			continue
+		}
+		delete(incomplete, pid)
+		for esPID, streamType := range parsePMT(payload) {
+			streamTypes[esPID] = streamType
+		}
+		pmtSections = append(pmtSections, indices)
+	}
+
+	// every packet is replaced by the packets of its slot, so that packets
+	// of different PIDs stay interleaved as they were
+	slots := make([][][]byte, len(packets))
+	for i, packet := range packets {
+		slots[i] = [][]byte{packet}
+	}
+
+	for _, indices := range pmtSections {
+		for k, packet := range rewritePMT(packetsAt(packets, indices)) {
+			slots[indices[k]] = [][]byte{packet}
+		}
+	}
+
+	// the indices of the packets of the PES packet each encrypted stream is in
+	pending := make(map[int][]int)
+	decryptPending := func(pid int) error {
+		indices := pending[pid]
+		delete(pending, pid)
+
+		rewritten, err := decryptPES(packetsAt(packets, indices), streamTypes[pid], sample)
+		if err != nil {
+			return err
+		}
+
+		// a PES packet that shrank leaves its last slots empty, one that
+		// grew continues after its last packet
+		for k, index := range indices {
+			slots[index] = nil
+			if k < len(rewritten) {
+				slots[index] = [][]byte{rewritten[k]}
+			}
+		}
+		if len(rewritten) > len(indices) {
+			last := indices[len(indices)-1]
+			slots[last] = append(slots[last], rewritten[len(indices):]...)
+		}
+		return nil
+	}
+
+	for i, packet := range packets {
+		pid := packetPID(packet)
+		if _, ok := sampleAESStreamTypes[streamTypes[pid]]; !ok {
+			continue
+		}
+		if _, ok := pending[pid]; ok && payloadUnitStart(packet) {
+			if err := decryptPending(pid); err != nil {
+				return nil, err
+			}
+		}
+		pending[pid] = append(pending[pid], i)
+	}
+	for pid := range pending {
+		if err := decryptPending(pid); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make([]byte, 0, len(data))
+	for _, slot := range slots {
+		for _, packet := range slot {
+			result = append(result, packet...)
+		}
+	}
+
+	output, err := splitPackets(result)
+	if err != nil {
+		return nil, err
+	}
+	renumberContinuityCounters(output, streamTypes)
+	return result, nil
+}
+
+// DecryptH264 decrypts the SAMPLE-AES encrypted NAL units of an H.264 Annex B
+// elementary stream. Emulation prevention bytes inserted after encryption are
+// removed from the encrypted NAL units.
+func DecryptH264(es []byte, keyBytes []byte, iv []byte) ([]byte, error) {
+	sample, err := newSampleCipher(keyBytes, iv)
+	if err != nil {
+		return nil, err
+	}
+	return decryptH264(es, sample), nil
+}
+
+// DecryptADTS decrypts the SAMPLE-AES encrypted frames of an AAC ADTS
+// elementary stream
+func DecryptADTS(es []byte, keyBytes []byte, iv []byte) ([]byte, error) {
+	sample, err := newSampleCipher(keyBytes, iv)
+	if err != nil {
+		return nil, err
+	}
+	return decryptADTS(es, sample)
+}
+
+// sampleCipher holds the key and the IV that every sample starts with
+type sampleCipher struct {
+	block cipher.Block
+	iv    []byte
+}
+
+// newSampleCipher validates the key and IV for sample decryption
+func newSampleCipher(keyBytes []byte, iv []byte) (*sampleCipher, error) {
+	if len(keyBytes) != 16 {
+		return nil, fmt.Errorf("decrypt: AES-128 key must be 16 bytes, got %d", len(keyBytes))
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("decrypt: IV must be %d bytes, got %d", aes.BlockSize, len(iv))
+	}
+
+	block, err := aes.NewCipher(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt: %w", err)
+	}
+
+	return &sampleCipher{block: block, iv: iv}, nil
+}
+
+// decryptH264 decrypts the slice NAL units of an Annex B elementary stream
+func decryptH264(es []byte, c *sampleCipher) []byte {
+	result := make([]byte, 0, len(es))
+	offset := 0
+
+	for offset < len(es) {
+		start, codeLength := findStartCode(es, offset)
+		if start == -1 {
+			result = append(result, es[offset:]...)
+			break
+		}
+
+		// anything before the start code belongs to the previous NAL unit
+		result = append(result, es[offset:start+codeLength]...)
+		nalStart := start + codeLength
+
+		next, _ := findStartCode(es, nalStart)
+		nalEnd := next
+		if next == -1 {
+			nalEnd = len(es)
+		}
+
+		result = append(result, decryptNALUnit(es[nalStart:nalEnd], c)...)
+		offset = nalEnd
+	}
+
+	return result
+}
+
+// decryptNALUnit decrypts a single NAL unit if it is an encrypted slice
+func decryptNALUnit(nal []byte, c *sampleCipher) []byte {
+	if len(nal) <= h264MinNALLength {
+		return nal
+	}
+
+	nalType := nal[0] & 0x1f
+	if nalType != 1 && nalType != 5 {
+		return nal
+	}
+
+	nal = removeEmulationPrevention(nal)
+	mode := cipher.NewCBCDecrypter(c.block, c.iv)
+
+	position := h264ClearLeader
+	for position < len(nal) {
+		if len(nal)-position > aes.BlockSize {
+			mode.CryptBlocks(nal[position:position+aes.BlockSize], nal[position:position+aes.BlockSize])
+			position += aes.BlockSize
+		}
+		position += h264ClearSkip
+	}
+
+	return nal
+}
+
+// decryptADTS decrypts the frames of an ADTS elementary stream
+func decryptADTS(es []byte, c *sampleCipher) ([]byte, error) {
+	result := make([]byte, len(es))
+	copy(result, es)
+
+	offset := 0
+	for offset+7 <= len(result) {
+		frame := result[offset:]
+		if frame[0] != 0xff || frame[1]&0xf0 != 0xf0 {
+			return nil, fmt.Errorf("decrypt: lost ADTS sync at offset %d", offset)
+		}
+
+		headerLength := 7
+		if frame[1]&0x01 == 0 {
+			headerLength = 9
+		}
+		frameLength := int(frame[3]&0x03)<<11 | int(frame[4])<<3 | int(frame[5])>>5
+		if frameLength < headerLength || frameLength > len(frame) {
+			return nil, fmt.Errorf("decrypt: invalid ADTS frame length %d at offset %d", frameLength, offset)
+		}
+
+		payload := frame[headerLength+min(aacClearLeader, frameLength-headerLength) : frameLength]
+		encrypted := len(payload) - len(payload)%aes.BlockSize
+		if encrypted > 0 {
+			cipher.NewCBCDecrypter(c.block, c.iv).CryptBlocks(payload[:encrypted], payload[:encrypted])
+		}
+
+		offset += frameLength
+	}
+
+	return result, nil
+}
+
+// decryptPES decrypts the elementary stream data of the PES packet carried
+// by packets and returns the packets carrying the decrypted PES packet
+func decryptPES(packets [][]byte, streamType byte, c *sampleCipher) ([][]byte, error) {
+	pes := joinPayloads(packets)
+
+	if len(pes) < 9 || pes[0] != 0 || pes[1] != 0 || pes[2] != 1 {
+		// not a complete PES packet, e.g. the tail of one that started in the previous segment
+		return packets, nil
+	}
+
+	headerLength := 9 + int(pes[8])
+	if headerLength > len(pes) {
+		return nil, fmt.Errorf("decrypt: truncated PES header")
+	}
+
+	es := pes[headerLength:]
+	var decrypted []byte
+	switch sampleAESStreamTypes[streamType] {
+	case 0x1b:
+		decrypted = decryptH264(es, c)
+	case 0x0f:
+		var err error
+		if decrypted, err = decryptADTS(es, c); err != nil {
+			return nil, err
+		}
+	}
+
+	rewritten := make([]byte, 0, headerLength+len(decrypted))
+	rewritten = append(rewritten, pes[:headerLength]...)
+	rewritten = append(rewritten, decrypted...)
+
+	// PES_packet_length counts the bytes following it; zero means unbounded
+	if pesLength := int(pes[4])<<8 | int(pes[5]); pesLength != 0 {
+		newLength := len(rewritten) - 6
+		if newLength > 0xffff {
+			newLength = 0
+		}
+		rewritten[4] = byte(newLength >> 8)
+		rewritten[5] = byte(newLength)
+	}
+
+	return repacketize(packets, rewritten), nil
+}
+
+// repacketize distributes payload over the given packets, keeping their
+// headers and adaptation fields. Space left in the last used packet is
+// filled with adaptation field stuffing, unused packets are dropped and
+// additional packets are added when the payload has grown.
+func repacketize(packets [][]byte, payload []byte) [][]byte {
+	result := [][]byte{}
+
+	for _, original := range packets {
+		if len(payload) == 0 {
+			break
+		}
+
+		packet := make([]byte, tsPacketSize)
+		copy(packet, original)
+		headerLength := tsPacketSize - len(packetPayload(original))
+		if !packetHasPayload(original) {
+			result = append(result, packet)
+			continue
+		}
+
+		packet = fitPayload(packet[:headerLength], payload)
+		payload = payload[len(packetPayload(packet)):]
+		result = append(result, packet)
+	}
+
+	for len(payload) > 0 {
+		packet := make([]byte, 4, tsPacketSize)
+		copy(packet, packets[len(packets)-1][:4])
+		packet[1] &^= 0x40 // payload_unit_start_indicator
+		packet[3] = packet[3]&^0x30 | 0x10
+
+		packet = fitPayload(packet, payload)
+		payload = payload[len(packetPayload(packet)):]
+		result = append(result, packet)
+	}
+
+	return result
+}
+
+// fitPayload completes a packet from its header (including any adaptation
+// field) and as much of payload as fits, stuffing the rest of the packet
+func fitPayload(header []byte, payload []byte) []byte {
+	capacity := tsPacketSize - len(header)
+	if len(payload) >= capacity {
+		return append(header, payload[:capacity]...)
+	}
+
+	stuffing := capacity - len(payload)
+	packet := make([]byte, 0, tsPacketSize)
+
+	if header[3]&0x20 != 0 {
+		// extend the existing adaptation field
+		adaptationLength := int(header[4])
+		packet = append(packet, header[:4]...)
+		if adaptationLength == 0 {
+			// an empty adaptation field needs its flags byte before it can be stuffed
+			packet = append(packet, byte(stuffing), 0x00)
+			for i := 1; i < stuffing; i++ {
+				packet = append(packet, 0xff)
+			}
+		} else {
+			packet = append(packet, byte(adaptationLength+stuffing))
+			packet = append(packet, header[5:5+adaptationLength]...)
+			for i := 0; i < stuffing; i++ {
+				packet = append(packet, 0xff)
+			}
+		}
+		packet = append(packet, header[5+adaptationLength:]...)
+	} else {
+		packet = append(packet, header[:4]...)
+		packet[3] |= 0x20
+		packet = append(packet, byte(stuffing-1))
+		if stuffing > 1 {
+			packet = append(packet, 0x00)
+			for i := 2; i < stuffing; i++ {
+				packet = append(packet, 0xff)
+			}
+		}
+		packet = append(packet, header[4:]...)
+	}
+
+	return append(packet, payload...)
+}
+
+// rewritePMT replaces the SAMPLE-AES stream types of the PMT section carried
+// by packets with their clear counterparts and returns the rewritten packets
+func rewritePMT(packets [][]byte) [][]byte {
+	rewritten := make([][]byte, len(packets))
+	for i, original := range packets {
+		rewritten[i] = make([]byte, tsPacketSize)
+		copy(rewritten[i], original)
+	}
+
+	payload := joinPayloads(rewritten)
+	if !sectionComplete(payload) {
+		return rewritten
+	}
+	section := payload[1+int(payload[0]):] // pointer_field
+
+	if len(section) < 12 || section[0] != 0x02 {
+		return rewritten
+	}
+	sectionLength := int(section[1]&0x0f)<<8 | int(section[2])
+	if sectionLength < 13 {
+		return rewritten
+	}
+
+	programInfoLength := int(section[10]&0x0f)<<8 | int(section[11])
+	offset := 12 + programInfoLength
+	end := 3 + sectionLength - 4
+	for offset+5 <= end {
+		if clear, ok := sampleAESStreamTypes[section[offset]]; ok {
+			section[offset] = clear
+		}
+		esInfoLength := int(section[offset+3]&0x0f)<<8 | int(section[offset+4])
+		offset += 5 + esInfoLength
+	}
+
+	crc := crc32MPEG(section[:end])
+	section[end] = byte(crc >> 24)
+	section[end+1] = byte(crc >> 16)
+	section[end+2] = byte(crc >> 8)
+	section[end+3] = byte(crc)
+
+	// the section keeps its size, so it fits the payloads it was read from
+	for _, packet := range rewritten {
+		payload = payload[copy(packetPayload(packet), payload):]
+	}
+	return rewritten
+}
+
+// sectionComplete returns true if a PSI payload, starting with its
+// pointer_field, contains the complete section
+func sectionComplete(payload []byte) bool {
+	if len(payload) < 1 || len(payload) < 1+int(payload[0])+3 {
+		return false
+	}
+	section := payload[1+int(payload[0]):]
+	sectionLength := int(section[1]&0x0f)<<8 | int(section[2])
+	return 3+sectionLength <= len(section)
+}
+
+// joinPayloads returns a copy of the payloads of packets
+func joinPayloads(packets [][]byte) []byte {
+	payload := []byte{}
+	for _, packet := range packets {
+		payload = append(payload, packetPayload(packet)...)
+	}
+	return payload
+}
+
+// packetsAt returns the packets at the given indices
+func packetsAt(packets [][]byte, indices []int) [][]byte {
+	selected := make([][]byte, len(indices))
+	for i, index := range indices {
+		selected[i] = packets[index]
+	}
+	return selected
+}
+
+// parsePAT returns the PMT PIDs listed in a PAT section
+func parsePAT(payload []byte) []int {
+	pids := []int{}
+	if len(payload) < 1 {
+		return pids
+	}
+	section := payload[1+int(payload[0]):]
+	if len(section) < 8 || section[0] != 0x00 {
+		return pids
+	}
+
+	sectionLength := int(section[1]&0x0f)<<8 | int(section[2])
+	end := min(3+sectionLength-4, len(section))
+	for offset := 8; offset+4 <= end; offset += 4 {
+		programNumber := int(section[offset])<<8 | int(section[offset+1])
+		if programNumber != 0 {
+			pids = append(pids, int(section[offset+2]&0x1f)<<8|int(section[offset+3]))
+		}
+	}
+	return pids
+}
+
+// parsePMT returns the stream types of the elementary streams listed in a PMT section
+func parsePMT(payload []byte) map[int]byte {
+	streams := make(map[int]byte)
+	if len(payload) < 1 {
+		return streams
+	}
+	section := payload[1+int(payload[0]):]
+	if len(section) < 12 || section[0] != 0x02 {
+		return streams
+	}
+
+	sectionLength := int(section[1]&0x0f)<<8 | int(section[2])
+	programInfoLength := int(section[10]&0x0f)<<8 | int(section[11])
+	end := min(3+sectionLength-4, len(section))
+	for offset := 12 + programInfoLength; offset+5 <= end; {
+		pid := int(section[offset+1]&0x1f)<<8 | int(section[offset+2])
+		streams[pid] = section[offset]
+		esInfoLength := int(section[offset+3]&0x0f)<<8 | int(section[offset+4])
+		offset += 5 + esInfoLength
+	}
+	return streams
+}
+
+// renumberContinuityCounters restores consecutive continuity counters on the
+// repacketized streams
+func renumberContinuityCounters(packets [][]byte, streamTypes map[int]byte) {
+	counters := make(map[int]byte)
+	for _, packet := range packets {
+		pid := packetPID(packet)
+		if _, ok := sampleAESStreamTypes[streamTypes[pid]]; !ok || !packetHasPayload(packet) {
+			continue
+		}
+
+		counter, seen := counters[pid]
+		if !seen {
+			counter = packet[3] & 0x0f
+		} else {
+			counter = (counter + 1) & 0x0f
+		}
+		packet[3] = packet[3]&0xf0 | counter
+		counters[pid] = counter
+	}
+}
+
+// splitPackets splits an MPEG-TS segment into its packets
+func splitPackets(data []byte) ([][]byte, error) {
+	if len(data)%tsPacketSize != 0 {
+		return nil, fmt.Errorf("decrypt: MPEG-TS data is not a multiple of %d bytes", tsPacketSize)
+	}
+
+	packets := make([][]byte, 0, len(data)/tsPacketSize)
+	for offset := 0; offset < len(data); offset += tsPacketSize {
+		packet := data[offset : offset+tsPacketSize]
+		if packet[0] != tsSyncByte {
+			return nil, fmt.Errorf("decrypt: lost MPEG-TS sync at offset %d", offset)
+		}
+		packets = append(packets, packet)
+	}
+	return packets, nil
+}
+
+// packetPID returns the PID of a packet
+func packetPID(packet []byte) int {
+	return int(packet[1]&0x1f)<<8 | int(packet[2])
+}
+
+// payloadUnitStart returns true if a PES packet or section starts in the packet
+func payloadUnitStart(packet []byte) bool {
+	return packet[1]&0x40 != 0
+}
+
+// packetHasPayload returns true if the packet carries a payload
+func packetHasPayload(packet []byte) bool {
+	return packet[3]&0x10 != 0
+}
+
+// packetPayload returns the payload of a packet
+func packetPayload(packet []byte) []byte {
+	if !packetHasPayload(packet) {
+		return nil
+	}
+
+	offset := 4
+	if packet[3]&0x20 != 0 {
+		offset += 1 + int(packet[4])
+	}
+	if offset > len(packet) {
+		return nil
+	}
+	return packet[offset:]
+}
+
+// findStartCode returns the position and length of the next Annex B start code
+func findStartCode(data []byte, from int) (int, int) {
+	for i := from; i+3 <= len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 {
+			continue
+		}
+		if data[i+2] == 1 {
+			return i, 3
+		}
+		if i+4 <= len(data) && data[i+2] == 0 && data[i+3] == 1 {
+			return i, 4
+		}
+	}
+	return -1, 0
+}
+
+// removeEmulationPrevention removes the emulation prevention bytes from a NAL unit
+func removeEmulationPrevention(nal []byte) []byte {
+	result := make([]byte, 0, len(nal))
+	zeros := 0
+	for _, b := range nal {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		result = append(result, b)
+	}
+	return result
+}
+
+// crc32MPEG computes the CRC-32/MPEG-2 checksum used by PSI sections
+func crc32MPEG(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
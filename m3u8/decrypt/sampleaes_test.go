@@ -0,0 +1,234 @@
+package decrypt
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+// known answers computed with openssl enc -aes-128-cbc -nopad
+var (
+	sampleKey, _ = hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	sampleIV, _  = hex.DecodeString("f0e0d0c0b0a090807060504030201000")
+	// the blocks at offsets 32 and 192 of h264Slice
+	h264Blocks, _ = hex.DecodeString("4a759542abe0469e96b9d4dcbf8e82ad0ef1b6b32cfdb32bba45a2217aa617b1")
+	// the blocks at offset 16 of the payload of the first frame of adtsFrames
+	adtsBlocks, _ = hex.DecodeString("a0b2773a5cc538d7f628028f6f97587e178e97cc51e8f9a384799bf0d9b841df")
+)
+
+// h264SPS is a NAL unit that is never encrypted
+var h264SPS = []byte{0x67, 0x42, 0xc0, 0x1e, 0xd9, 0x01, 0x40}
+
+// h264Slice returns a clear IDR slice of 213 bytes, of which the blocks at
+// offsets 32 and 192 are encrypted and the last 5 bytes stay clear
+func h264Slice() []byte {
+	nal := []byte{0x65}
+	for i := 1; i < 213; i++ {
+		nal = append(nal, byte(i*37+11))
+	}
+	return nal
+}
+
+// h264Streams returns an Annex B stream and its SAMPLE-AES encrypted form
+func h264Streams() ([]byte, []byte) {
+	slice := h264Slice()
+	encrypted := append([]byte{}, slice...)
+	copy(encrypted[32:48], h264Blocks[:16])
+	copy(encrypted[192:208], h264Blocks[16:])
+
+	annexB := func(slice []byte) []byte {
+		stream := append([]byte{0, 0, 0, 1}, h264SPS...)
+		stream = append(stream, 0, 0, 0, 1)
+		return append(stream, slice...)
+	}
+	return annexB(slice), annexB(encrypted)
+}
+
+// adtsFrame prepends an ADTS header without CRC to payload
+func adtsFrame(payload []byte) []byte {
+	length := 7 + len(payload)
+	header := []byte{0xff, 0xf1, 0x50, 0x80 | byte(length>>11&0x03), byte(length >> 3), byte(length&0x07)<<5 | 0x1f, 0xfc}
+	return append(header, payload...)
+}
+
+// adtsStreams returns two ADTS frames and their SAMPLE-AES encrypted form.
+// The 56 byte payload of the first frame has two encrypted blocks after its
+// 16 clear bytes, the 12 byte payload of the second frame stays clear.
+func adtsStreams() ([]byte, []byte) {
+	first := make([]byte, 56)
+	for i := range first {
+		first[i] = byte(i*53 + 7)
+	}
+	second := make([]byte, 12)
+	for i := range second {
+		second[i] = byte(i*29 + 3)
+	}
+
+	encrypted := append([]byte{}, first...)
+	copy(encrypted[16:48], adtsBlocks)
+
+	clear := append(adtsFrame(first), adtsFrame(second)...)
+	return clear, append(adtsFrame(encrypted), adtsFrame(second)...)
+}
+
+func TestDecryptH264(t *testing.T) {
+	clear, encrypted := h264Streams()
+	got, err := DecryptH264(encrypted, sampleKey, sampleIV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, clear) {
+		t.Errorf("got %x, want %x", got, clear)
+	}
+}
+
+func TestDecryptADTS(t *testing.T) {
+	clear, encrypted := adtsStreams()
+	got, err := DecryptADTS(encrypted, sampleKey, sampleIV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, clear) {
+		t.Errorf("got %x, want %x", got, clear)
+	}
+}
+
+// Stream PIDs of the test transport stream
+const (
+	testPMTPID   = 0x1000
+	testVideoPID = 0x100
+	testAudioPID = 0x101
+)
+
+// tsPacket returns a packet carrying payload, stuffed with an adaptation
+// field if it is shorter than the packet
+func tsPacket(pid int, start bool, counter int, payload []byte) []byte {
+	packet := []byte{tsSyncByte, byte(pid >> 8), byte(pid), 0x10 | byte(counter&0x0f)}
+	if start {
+		packet[1] |= 0x40
+	}
+	if stuffing := tsPacketSize - 4 - len(payload); stuffing > 0 {
+		packet[3] |= 0x20
+		packet = append(packet, byte(stuffing-1))
+		if stuffing > 1 {
+			packet = append(packet, 0x00)
+			packet = append(packet, bytes.Repeat([]byte{0xff}, stuffing-2)...)
+		}
+	}
+	return append(packet, payload...)
+}
+
+// psiPackets splits a section into packets, filling the last one with 0xff
+func psiPackets(pid int, section []byte) [][]byte {
+	payload := append([]byte{0}, section...)
+	if rest := len(payload) % (tsPacketSize - 4); rest != 0 {
+		payload = append(payload, bytes.Repeat([]byte{0xff}, tsPacketSize-4-rest)...)
+	}
+
+	packets := [][]byte{}
+	for i := 0; i < len(payload); i += tsPacketSize - 4 {
+		packets = append(packets, tsPacket(pid, i == 0, len(packets), payload[i:i+tsPacketSize-4]))
+	}
+	return packets
+}
+
+// pesPackets packs an elementary stream into a PES packet and splits it
+// into packets
+func pesPackets(pid int, streamID byte, es []byte) [][]byte {
+	pes := []byte{0, 0, 1, streamID, 0, 0, 0x80, 0x80, 0x05, 0x21, 0x00, 0x01, 0x00, 0x01}
+	pes = append(pes, es...)
+	length := len(pes) - 6
+	pes[4], pes[5] = byte(length>>8), byte(length)
+
+	packets := [][]byte{}
+	for i := 0; i < len(pes); i += tsPacketSize - 4 {
+		end := min(i+tsPacketSize-4, len(pes))
+		packets = append(packets, tsPacket(pid, i == 0, len(packets), pes[i:end]))
+	}
+	return packets
+}
+
+// section completes a PSI section with its length and CRC
+func section(tableID byte, body []byte) []byte {
+	length := 5 + len(body) + 4
+	section := []byte{tableID, 0xb0 | byte(length>>8), byte(length), 0x00, 0x01, 0xc1, 0x00, 0x00}
+	section = append(section, body...)
+	crc := crc32MPEG(section)
+	return append(section, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+// pmtSection returns a PMT whose program descriptors make it span two packets
+func pmtSection(videoType, audioType byte) []byte {
+	descriptors := []byte{}
+	for i := 0; i < 2; i++ {
+		descriptors = append(descriptors, 0xc0, 98)
+		descriptors = append(descriptors, bytes.Repeat([]byte{byte(i)}, 98)...)
+	}
+
+	body := []byte{0xe0 | byte(testVideoPID>>8), byte(testVideoPID & 0xff), 0xf0 | byte(len(descriptors)>>8), byte(len(descriptors))}
+	body = append(body, descriptors...)
+	body = append(body, videoType, 0xe0|byte(testVideoPID>>8), byte(testVideoPID&0xff), 0xf0, 0x00)
+	body = append(body, audioType, 0xe0|byte(testAudioPID>>8), byte(testAudioPID&0xff), 0xf0, 0x00)
+	return section(0x02, body)
+}
+
+// transportStream interleaves the packets of a PAT, a PMT spanning two
+// packets, a video PES spanning two packets and an audio PES
+func transportStream(videoType, audioType byte, video, audio []byte) []byte {
+	pat := psiPackets(patPID, section(0x00, []byte{0x00, 0x01, 0xe0 | byte(testPMTPID>>8), byte(testPMTPID & 0xff)}))
+	pmt := psiPackets(testPMTPID, pmtSection(videoType, audioType))
+	videoPES := pesPackets(testVideoPID, 0xe0, video)
+	audioPES := pesPackets(testAudioPID, 0xc0, audio)
+
+	stream := []byte{}
+	for _, packet := range [][]byte{pat[0], pmt[0], videoPES[0], pmt[1], audioPES[0], videoPES[1]} {
+		stream = append(stream, packet...)
+	}
+	return stream
+}
+
+func TestDecryptSampleAESSegment(t *testing.T) {
+	clearVideo, encryptedVideo := h264Streams()
+	clearAudio, encryptedAudio := adtsStreams()
+	encrypted := transportStream(0xdb, 0xcf, encryptedVideo, encryptedAudio)
+	want := transportStream(0x1b, 0x0f, clearVideo, clearAudio)
+
+	p := parser.New()
+	p.Push(`#EXTM3U
+#EXT-X-VERSION:5
+#EXT-X-TARGETDURATION:10
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="skd://key",KEYFORMAT="com.apple.streamingkeydelivery",KEYFORMATVERSIONS="1"
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="key.bin",IV=0xf0e0d0c0b0a090807060504030201000
+#EXTINF:10,
+segment.ts
+#EXT-X-ENDLIST
+`)
+	if err := p.End(); err != nil {
+		t.Fatal(err)
+	}
+
+	original := append([]byte{}, encrypted...)
+	got, err := DecryptSampleAESSegment(encrypted, p.Manifest.Segments[0], 0, sampleKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encrypted, original) {
+		t.Error("the input was modified")
+	}
+
+	gotPackets, err := splitPackets(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPackets, _ := splitPackets(want)
+	if len(gotPackets) != len(wantPackets) {
+		t.Fatalf("got %d packets, want %d", len(gotPackets), len(wantPackets))
+	}
+	for i := range wantPackets {
+		if !bytes.Equal(gotPackets[i], wantPackets[i]) {
+			t.Errorf("packet %d (PID %#x): got %x, want %x", i, packetPID(wantPackets[i]), gotPackets[i], wantPackets[i])
+		}
+	}
+}
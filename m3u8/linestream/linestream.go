@@ -10,28 +10,35 @@ import (
 // LineStream is a stream that buffers string input and generates a data event for each line
 type LineStream struct {
 	*stream.Stream
-	buffer string
+	// partial holds the start of the line that has not ended yet
+	partial strings.Builder
 }
 
 // NewLineStream creates a new LineStream instance
 func NewLineStream() *LineStream {
 	return &LineStream{
 		Stream: stream.NewStream(),
-		buffer: "",
 	}
 }
 
-// Push adds new data to be parsed
+// Push adds new data to be parsed. Only data is searched for line feeds, so
+// pushing a playlist in many small chunks takes linear time.
 func (ls *LineStream) Push(data string) {
-	ls.buffer += data
-	nextNewline := strings.Index(ls.buffer, "\n")
+	nextNewline := strings.IndexByte(data, '\n')
 
 	for nextNewline > -1 {
-		line := ls.buffer[:nextNewline]
+		line := data[:nextNewline]
+		if ls.partial.Len() > 0 {
+			ls.partial.WriteString(line)
+			line = ls.partial.String()
+			ls.partial.Reset()
+		}
 		ls.Trigger("data", map[string]interface{}{
 			"data": line,
 		})
-		ls.buffer = ls.buffer[nextNewline+1:]
-		nextNewline = strings.Index(ls.buffer, "\n")
+		data = data[nextNewline+1:]
+		nextNewline = strings.IndexByte(data, '\n')
 	}
+
+	ls.partial.WriteString(data)
 }
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"fmt"
+)
+
+// MergeDelta applies a playlist delta update (a playlist requested with
+// _HLS_skip=YES or _HLS_skip=v2 that contains an #EXT-X-SKIP tag) onto the
+// previously parsed snapshot of the same playlist and returns the complete
+// playlist. Neither previous nor delta is modified.
+//
+// The segments replaced by #EXT-X-SKIP are taken from previous, the remaining
+// segments and all other playlist information come from delta. When the delta
+// skipped date ranges, the date ranges of previous are kept, except for those
+// listed in RECENTLY-REMOVED-DATERANGES, and updated by the date ranges of delta.
+func MergeDelta(previous *Manifest, delta *Manifest) (*Manifest, error) {
+	if previous == nil || delta == nil {
+		return nil, fmt.Errorf("merge delta: both the previous playlist and the delta update are required")
+	}
+
+	merged := *delta
+	merged.Skip = nil
+
+	skippedSegments := 0
+	if delta.Skip != nil {
+		skippedSegments = delta.Skip.SkippedSegments
+	}
+
+	// the first skipped segment has the media sequence number of the delta update
+	start := delta.MediaSequence - previous.MediaSequence
+	if skippedSegments > 0 && (start < 0 || start+skippedSegments > len(previous.Segments)) {
+		return nil, fmt.Errorf("merge delta: skipped segments %d-%d are not part of the previous playlist (%d-%d)",
+			delta.MediaSequence, delta.MediaSequence+skippedSegments-1,
+			previous.MediaSequence, previous.MediaSequence+len(previous.Segments)-1)
+	}
+
+	merged.Segments = make([]*Segment, 0, skippedSegments+len(delta.Segments))
+	if skippedSegments > 0 {
+		for _, segment := range previous.Segments[start : start+skippedSegments] {
+			merged.Segments = append(merged.Segments, copySegment(segment))
+		}
+	}
+	for _, segment := range delta.Segments {
+		merged.Segments = append(merged.Segments, copySegment(segment))
+	}
+
+	// the delta update only counted the discontinuities it contained itself,
+	// so the timelines and discontinuity starts are rebuilt for the full list
+	merged.DiscontinuityStarts = []int{}
+	currentTimeline := merged.DiscontinuitySequence
+	for i, segment := range merged.Segments {
+		if segment.Discontinuity {
+			currentTimeline++
+			merged.DiscontinuityStarts = append(merged.DiscontinuityStarts, i)
+		}
+		segment.Timeline = currentTimeline
+	}
+
+	if merged.PreloadSegment != nil {
+		preloadSegment := copySegment(merged.PreloadSegment)
+		preloadSegment.Timeline = currentTimeline
+		merged.PreloadSegment = preloadSegment
+	}
+
+	// date ranges were only skipped when the server listed the recently removed ones
+	if delta.Skip != nil && delta.Skip.RecentlyRemovedDateRanges != nil {
+		merged.DateRanges = mergeDateRanges(previous.DateRanges, delta.DateRanges, delta.Skip.RecentlyRemovedDateRanges)
+	}
+
+	return &merged, nil
+}
+
+// mergeDateRanges returns the previous date ranges without the removed IDs,
+// updated and extended by the date ranges of the delta update
+func mergeDateRanges(previous []*DateRange, delta []*DateRange, removed []string) []*DateRange {
+	removedIDs := make(map[string]bool)
+	for _, id := range removed {
+		if id != "" {
+			removedIDs[id] = true
+		}
+	}
+
+	updated := make(map[string]*DateRange)
+	for _, dateRange := range delta {
+		updated[dateRange.ID] = dateRange
+	}
+
+	result := []*DateRange{}
+	for _, dateRange := range previous {
+		if removedIDs[dateRange.ID] {
+			continue
+		}
+		if update, ok := updated[dateRange.ID]; ok {
+			result = append(result, update)
+			delete(updated, dateRange.ID)
+			continue
+		}
+		result = append(result, dateRange)
+	}
+
+	for _, dateRange := range delta {
+		if _, ok := updated[dateRange.ID]; ok {
+			result = append(result, dateRange)
+		}
+	}
+
+	return result
+}
+
+// copySegment returns a shallow copy of a segment
+func copySegment(segment *Segment) *Segment {
+	copied := *segment
+	return &copied
+}
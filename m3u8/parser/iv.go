@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// IVSize is the size of an AES-128 initialization vector in bytes
+const IVSize = 16
+
+// IVBytes returns the explicit IV of the key as 16 bytes, or nil if the key
+// has no IV attribute. Shorter hexadecimal values are treated as big-endian
+// integers and padded with leading zeros.
+func (k *Key) IVBytes() ([]byte, error) {
+	if k.IV == "" {
+		return nil, nil
+	}
+
+	value := k.IV
+	if strings.HasPrefix(strings.ToLower(value), "0x") {
+		value = value[2:]
+	}
+	if len(value)%2 == 1 {
+		value = "0" + value
+	}
+
+	if value == "" {
+		return nil, fmt.Errorf("invalid IV %q: no hexadecimal digits", k.IV)
+	}
+
+	decoded, err := hex.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IV %q: %w", k.IV, err)
+	}
+	if len(decoded) > IVSize {
+		return nil, fmt.Errorf("invalid IV %q: longer than %d bytes", k.IV, IVSize)
+	}
+
+	iv := make([]byte, IVSize)
+	copy(iv[IVSize-len(decoded):], decoded)
+	return iv, nil
+}
+
+// EffectiveIV returns the IV used to decrypt the segment with the given media
+// sequence number: the explicit IV of the key if present, otherwise the media
+// sequence number as a 128-bit big-endian integer. A malformed explicit IV is
+// an error rather than a reason to fall back to the media sequence number.
+func (k *Key) EffectiveIV(mediaSequence int) ([]byte, error) {
+	iv, err := k.IVBytes()
+	if err != nil || iv != nil {
+		return iv, err
+	}
+
+	if mediaSequence < 0 {
+		return nil, fmt.Errorf("invalid media sequence number %d", mediaSequence)
+	}
+
+	iv = make([]byte, IVSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(mediaSequence))
+	return iv, nil
+}
+
+// IV returns the effective IV of the identity key of the segment, given its
+// media sequence number. It returns nil if the segment is not encrypted with
+// a key of DefaultKeyFormat; keys of DRM systems such as FairPlay are
+// ignored.
+func (s *Segment) IV(mediaSequence int) ([]byte, error) {
+	key := s.KeyForFormat(DefaultKeyFormat)
+	if key == nil {
+		return nil, nil
+	}
+	return key.EffectiveIV(mediaSequence)
+}
+
+// IV returns the IV of the identity key of an encrypted initialization
+// segment, which has no media sequence number and therefore requires an
+// explicit IV. It returns nil if the initialization segment is not encrypted
+// with a key of DefaultKeyFormat.
+func (m *Map) IV() ([]byte, error) {
+	key := m.KeyForFormat(DefaultKeyFormat)
+	if key == nil {
+		return nil, nil
+	}
+
+	iv, err := key.IVBytes()
+	if err != nil {
+		return nil, err
+	}
+	if iv == nil {
+		return nil, fmt.Errorf("encrypted initialization segment %s lacks an explicit IV", m.URI)
+	}
+	return iv, nil
+}
+
+// SegmentMediaSequence returns the media sequence number of the segment at index
+func (m *Manifest) SegmentMediaSequence(index int) int {
+	return m.MediaSequence + index
+}
+
+// SegmentIV returns the effective IV of the segment at index, deriving it from
+// the media sequence number when the identity key has no explicit IV. It
+// returns nil if the segment is not encrypted with the identity key.
+func (m *Manifest) SegmentIV(index int) ([]byte, error) {
+	if index < 0 || index >= len(m.Segments) {
+		return nil, fmt.Errorf("segment index %d out of range", index)
+	}
+	return m.Segments[index].IV(m.SegmentMediaSequence(index))
+}
@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"fmt"
+)
+
+// EncryptionMethod is the METHOD of an #EXT-X-KEY or #EXT-X-SESSION-KEY tag
+type EncryptionMethod string
+
+// Encryption methods defined for #EXT-X-KEY
+const (
+	// MethodNone means the following segments are not encrypted
+	MethodNone EncryptionMethod = "NONE"
+	// MethodAES128 encrypts whole segments with AES-128-CBC and PKCS#7 padding
+	MethodAES128 EncryptionMethod = "AES-128"
+	// MethodSampleAES encrypts individual media samples, e.g. H.264 NAL units
+	// and AAC frames in MPEG-TS, with AES-128-CBC
+	MethodSampleAES EncryptionMethod = "SAMPLE-AES"
+	// MethodSampleAESCTR encrypts fragmented MP4 samples with AES-128-CTR ('cenc')
+	MethodSampleAESCTR EncryptionMethod = "SAMPLE-AES-CTR"
+)
+
+// IsValid returns true for the encryption methods defined for HLS
+func (m EncryptionMethod) IsValid() bool {
+	switch m {
+	case MethodNone, MethodAES128, MethodSampleAES, MethodSampleAESCTR:
+		return true
+	}
+	return false
+}
+
+// IsSampleEncryption returns true if the method encrypts individual media
+// samples rather than whole segments
+func (m EncryptionMethod) IsSampleEncryption() bool {
+	return m == MethodSampleAES || m == MethodSampleAESCTR
+}
+
+// Validate checks the key for a known METHOD, a URI and a well-formed IV
+func (k *Key) Validate() error {
+	if !k.Method.IsValid() {
+		return fmt.Errorf("has unknown METHOD %s", k.Method)
+	}
+
+	if k.Method == MethodNone {
+		return nil
+	}
+
+	if k.URI == "" {
+		return fmt.Errorf("with METHOD=%s lacks URI", k.Method)
+	}
+
+	if _, err := k.IVBytes(); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,396 @@
+package parser
+
+import "strings"
+
+// Line is an input line retained by a parser in lossless mode
+type Line struct {
+	// Text is the line exactly as it appeared in the input, without the
+	// line feed but including a carriage return
+	Text string
+	// TagType is the tag type reported by parsestream, "uri" for URI lines,
+	// "comment" for comments, "custom" for lines matched by AddParser and
+	// empty for unknown tags and blank lines
+	TagType string
+
+	// entry is the entry of a collection declared by the line, if any
+	entry entryKey
+}
+
+// segmentTagTypes are the tags that describe the segment or variant stream
+// that follows them. They are regenerated when a modified segment is written.
+var segmentTagTypes = map[string]bool{
+	"inf":               true,
+	"byterange":         true,
+	"key":               true,
+	"map":               true,
+	"discontinuity":     true,
+	"gap":               true,
+	"bitrate":           true,
+	"program-date-time": true,
+	"cue-out":           true,
+	"cue-out-cont":      true,
+	"cue-in":            true,
+	"part":              true,
+	"preload-hint":      true,
+	"stream-inf":        true,
+	"uri":               true,
+}
+
+// collectionTagTypes are the tags that declare one entry of a collection of
+// the manifest each, such as a date range or a rendition
+var collectionTagTypes = []string{
+	"session-data", "session-key", "media", "daterange", "i-frame-playlist", "rendition-report",
+}
+
+// entryKey identifies an entry of a collection: the pointer to a session
+// data, session key, date range, i-frame playlist or rendition report, or
+// the renditionKey of a rendition
+type entryKey interface{}
+
+// renditionKey identifies a rendition by its TYPE, GROUP-ID and NAME
+type renditionKey struct {
+	mediaType, groupID, name string
+}
+
+// lineRecorder retains the input lines of a parser in lossless mode and
+// assigns them to the manifest and its segments
+type lineRecorder struct {
+	header  []*Line
+	pending []*Line
+	// started is set once the first line describing a segment or variant
+	// stream has been read, which ends the header
+	started bool
+	// endsWithNewline is set if the input read so far ends with a line feed
+	endsWithNewline bool
+	// discard is set while flushing input that ends with a line feed, which
+	// produces an empty line that is not part of the input
+	discard bool
+	// taken counts the segments and variant streams the lines were taken for
+	taken int
+}
+
+// add retains a line read by the line stream
+func (r *lineRecorder) add(text string) {
+	if r.discard {
+		r.discard = false
+		return
+	}
+	r.pending = append(r.pending, &Line{Text: text})
+}
+
+// classify records the tag type of the most recent line, ending the header
+// at the first line that describes a segment or variant stream
+func (r *lineRecorder) classify(tagType string) {
+	if len(r.pending) == 0 {
+		return
+	}
+
+	last := len(r.pending) - 1
+	r.pending[last].TagType = tagType
+
+	if !r.started && segmentTagTypes[tagType] {
+		r.started = true
+		r.header = append(r.header, r.pending[:last]...)
+		r.pending = r.pending[last:]
+	}
+}
+
+// attach records the entry of a collection declared by the most recent line
+func (r *lineRecorder) attach(key entryKey) {
+	if len(r.pending) > 0 {
+		r.pending[len(r.pending)-1].entry = key
+	}
+}
+
+// take returns the lines read since the previous segment or variant stream
+func (r *lineRecorder) take() []*Line {
+	lines := r.pending
+	r.pending = nil
+	r.taken++
+	return lines
+}
+
+// finish attaches the header and the remaining lines to the manifest and
+// records how the manifest would be written before any modification
+func (r *lineRecorder) finish(m *Manifest) {
+	m.Lines = append([]*Line{}, r.header...)
+	m.TrailingLines = r.take()
+	m.noFinalNewline = !r.endsWithNewline
+
+	w := &playlistWriter{}
+	m.canonical = make(map[string]string)
+	for _, tagType := range headerTagTypes {
+		m.canonical[tagType] = w.renderTag(m, tagType)
+	}
+
+	m.canonicalEntries = make(map[entryKey]string)
+	for _, tagType := range collectionTagTypes {
+		for _, entry := range w.collection(m, tagType) {
+			m.canonicalEntries[entry.key] = entry.line
+		}
+	}
+
+	state := segmentState{}
+	for _, segment := range m.Segments {
+		segment.before = state
+		segment.canonical = canonicalSegment(segment)
+		state = stateAfter(segment)
+	}
+
+	for _, playlist := range m.Playlists {
+		playlist.canonical = canonicalVariant(playlist)
+	}
+}
+
+// canonicalSegment returns a segment as it is written without any keys or
+// initialization segment already active
+func canonicalSegment(segment *Segment) string {
+	w := &playlistWriter{}
+	w.writeSegment(0, segment, &segmentState{})
+	return w.buf.String()
+}
+
+// canonicalVariant returns a variant stream as it is written
+func canonicalVariant(playlist *Variant) string {
+	w := &playlistWriter{}
+	w.writeVariant(0, playlist, nil)
+	return w.buf.String()
+}
+
+// writeLossless writes a manifest parsed in lossless mode. Retained lines are
+// written as they were read unless the information they represent has been
+// modified or removed; segments, variant streams and other entries that were
+// added are written as usual.
+func (w *playlistWriter) writeLossless(m *Manifest) {
+	// lines that are not retained follow the line endings of the input
+	w.crlf = len(m.Lines) > 0 && strings.HasSuffix(m.Lines[0].Text, "\r")
+
+	w.entries = make(map[entryKey]string)
+	w.writtenEntries = make(map[entryKey]bool)
+	for _, tagType := range collectionTagTypes {
+		for _, entry := range w.collection(m, tagType) {
+			w.entries[entry.key] = entry.line
+		}
+	}
+
+	written := make(map[string]bool)
+	for _, line := range m.Lines {
+		w.writeRetained(m, line, written)
+	}
+
+	// header tags and entries that have been added to the manifest
+	for _, tagType := range headerTagTypes {
+		if tagType != "endlist" {
+			w.writeAddedTag(m, tagType, written)
+		}
+	}
+	for _, tagType := range []string{"session-data", "session-key", "media", "daterange"} {
+		w.writeAddedEntries(m, tagType)
+	}
+
+	// segments and variant streams are written in the order they were read,
+	// even if the playlist mixes them; added ones follow the one before them
+	state := &segmentState{}
+	segmentPosition, variantPosition := 0, 0
+	for i, j := 0, 0; i < len(m.Segments) || j < len(m.Playlists); {
+		if i < len(m.Segments) && m.Segments[i].position > 0 {
+			segmentPosition = m.Segments[i].position
+		}
+		if j < len(m.Playlists) && m.Playlists[j].position > 0 {
+			variantPosition = m.Playlists[j].position
+		}
+
+		if j == len(m.Playlists) || (i < len(m.Segments) && segmentPosition <= variantPosition) {
+			w.writeLosslessSegment(m, i, m.Segments[i], state)
+			i++
+		} else {
+			w.writeLosslessVariant(m, j, m.Playlists[j])
+			j++
+		}
+	}
+
+	w.writeAddedEntries(m, "i-frame-playlist")
+	w.writeAddedEntries(m, "rendition-report")
+
+	for _, line := range m.TrailingLines {
+		w.writeRetained(m, line, written)
+	}
+	w.writeAddedTag(m, "endlist", written)
+
+	if m.noFinalNewline && w.buf.Len() > 0 {
+		w.buf.Truncate(w.buf.Len() - 1)
+	}
+}
+
+// writeLosslessSegment writes the retained lines of a segment unless it has
+// been modified since it was read
+func (w *playlistWriter) writeLosslessSegment(m *Manifest, i int, segment *Segment, state *segmentState) {
+	if segment.Lines != nil && canonicalSegment(segment) == segment.canonical {
+		// the lines of the segment rely on the keys, initialization segment
+		// and bitrate declared before them
+		w.restoreState(state, segment.before)
+		w.writeLines(m, segment.Lines)
+		*state = stateAfter(segment)
+		return
+	}
+	w.writeUnknownLines(m, segment.Lines)
+	w.writeSegment(i, segment, state)
+}
+
+// writeLosslessVariant writes the retained lines of a variant stream unless
+// it has been modified since it was read
+func (w *playlistWriter) writeLosslessVariant(m *Manifest, i int, playlist *Variant) {
+	if playlist.Lines != nil && canonicalVariant(playlist) == playlist.canonical {
+		w.writeLines(m, playlist.Lines)
+		return
+	}
+	w.writeUnknownLines(m, playlist.Lines)
+
+	var original *Line
+	for _, line := range playlist.Lines {
+		if line.TagType == "stream-inf" {
+			original = line
+		}
+	}
+	w.writeVariant(i, playlist, original)
+}
+
+// writeRetained writes a retained line of the header or the end of the
+// playlist, replacing tags that occur at most once per playlist if their
+// information has been modified
+func (w *playlistWriter) writeRetained(m *Manifest, line *Line, written map[string]bool) {
+	original, ok := m.canonical[line.TagType]
+	if !ok {
+		w.writeRetainedLine(m, line)
+		return
+	}
+
+	current := w.renderTag(m, line.TagType)
+	if current == original {
+		w.raw(line.Text)
+	} else if current != "" && !written[line.TagType] {
+		w.line(current)
+	}
+	written[line.TagType] = true
+}
+
+// writeAddedTag writes a tag that occurs at most once per playlist if it was
+// not read but has since been added to the manifest
+func (w *playlistWriter) writeAddedTag(m *Manifest, tagType string, written map[string]bool) {
+	if written[tagType] {
+		return
+	}
+	if current := w.renderTag(m, tagType); current != "" && current != m.canonical[tagType] {
+		w.line(current)
+	}
+}
+
+// writeRetainedLine writes a retained line as it was read, unless it declares
+// an entry of a collection that has since been modified or removed. Modified
+// entries keep the order of the attributes of the line.
+func (w *playlistWriter) writeRetainedLine(m *Manifest, line *Line) {
+	if line.entry == nil {
+		w.raw(line.Text)
+		return
+	}
+
+	current, ok := w.entries[line.entry]
+	if !ok {
+		return
+	}
+
+	if current == m.canonicalEntries[line.entry] {
+		w.raw(line.Text)
+	} else if !w.writtenEntries[line.entry] {
+		w.line(keepAttributeOrder(current, line.Text))
+	}
+	w.writtenEntries[line.entry] = true
+}
+
+// writeAddedEntries writes the entries of a collection that were not read but
+// have since been added to the manifest
+func (w *playlistWriter) writeAddedEntries(m *Manifest, tagType string) {
+	for _, entry := range w.collection(m, tagType) {
+		if _, ok := m.canonicalEntries[entry.key]; !ok && !w.writtenEntries[entry.key] {
+			w.line(entry.line)
+			w.writtenEntries[entry.key] = true
+		}
+	}
+}
+
+// keepAttributeOrder returns the line of a tag with its attributes in the
+// order of the original line. Attributes the original line lacks follow in
+// their order in line.
+func keepAttributeOrder(line, original string) string {
+	name, list, ok := strings.Cut(line, ":")
+	if !ok {
+		return line
+	}
+	_, originalList, _ := strings.Cut(strings.TrimSuffix(original, "\r"), ":")
+
+	attrs := splitAttributes(list)
+	byName := make(map[string]string, len(attrs))
+	for _, attr := range attrs {
+		byName[attributeName(attr)] = attr
+	}
+
+	ordered := make([]string, 0, len(attrs))
+	for _, attr := range splitAttributes(originalList) {
+		if current, ok := byName[attributeName(attr)]; ok {
+			ordered = append(ordered, current)
+			delete(byName, attributeName(attr))
+		}
+	}
+	for _, attr := range attrs {
+		if _, ok := byName[attributeName(attr)]; ok {
+			ordered = append(ordered, attr)
+		}
+	}
+
+	return name + ":" + strings.Join(ordered, ",")
+}
+
+// splitAttributes splits an attribute list at the commas outside quoted strings
+func splitAttributes(list string) []string {
+	attrs := []string{}
+	quoted, start := false, 0
+	for i := 0; i < len(list); i++ {
+		switch list[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				attrs = append(attrs, list[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if start < len(list) {
+		attrs = append(attrs, list[start:])
+	}
+	return attrs
+}
+
+// attributeName returns the name of an attribute of an attribute list
+func attributeName(attr string) string {
+	name, _, _ := strings.Cut(attr, "=")
+	return strings.TrimSpace(name)
+}
+
+// writeLines writes retained lines as they were read
+func (w *playlistWriter) writeLines(m *Manifest, lines []*Line) {
+	for _, line := range lines {
+		w.writeRetainedLine(m, line)
+	}
+}
+
+// writeUnknownLines writes the retained lines of a modified segment or
+// variant stream that are not regenerated, such as comments, unknown tags
+// and date ranges
+func (w *playlistWriter) writeUnknownLines(m *Manifest, lines []*Line) {
+	for _, line := range lines {
+		if !segmentTagTypes[line.TagType] && strings.TrimSpace(line.Text) != "" {
+			w.writeRetainedLine(m, line)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLosslessRoundTrip(t *testing.T) {
+	for _, name := range fixtures {
+		input := readFixture(t, name)
+		tests := []struct {
+			name     string
+			playlist string
+			// chunkSize is the size of the chunks pushed, 0 for all at once
+			chunkSize int
+		}{
+			{name, input, 0},
+			{name + " with CRLF", strings.ReplaceAll(input, "\n", "\r\n"), 0},
+			{name + " without final newline", strings.TrimRight(input, "\n"), 0},
+			{name + " in chunks", input, 7},
+		}
+
+		for _, test := range tests {
+			p := New(WithLossless())
+			chunkSize := test.chunkSize
+			if chunkSize == 0 {
+				chunkSize = len(test.playlist)
+			}
+			for i := 0; i < len(test.playlist); i += chunkSize {
+				p.Push(test.playlist[i:min(i+chunkSize, len(test.playlist))])
+			}
+			if err := p.End(); err != nil {
+				t.Fatal(err)
+			}
+
+			output, err := p.Manifest.Marshal()
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+				continue
+			}
+			if string(output) != test.playlist {
+				t.Errorf("%s: got\n%s\nwant\n%s", test.name, output, test.playlist)
+			}
+		}
+	}
+}
+
+func TestLosslessModifiedMixedPlaylist(t *testing.T) {
+	input := readFixture(t, "complex.m3u8")
+	manifest := parseString(t, input, WithLossless())
+	if len(manifest.Segments) == 0 || len(manifest.Playlists) == 0 {
+		t.Fatal("complex.m3u8 should contain media segments and variant streams")
+	}
+
+	manifest.Segments[1].Duration = 8
+	manifest.Playlists[1].Bandwidth = 1500000
+	manifest.Playlists = append(manifest.Playlists, NewVariant("playlist_1080.m3u8", map[string]string{"BANDWIDTH": "5000000"}))
+
+	want := strings.Replace(input, "#EXTINF:9.009,\nsegment2.ts", "#EXTINF:8,\nsegment2.ts", 1)
+	want = strings.Replace(want,
+		`#EXT-X-STREAM-INF:BANDWIDTH=1400000,RESOLUTION=842x480,CODECS="avc1.4d001f,mp4a.40.2",AUDIO="audio"`,
+		`#EXT-X-STREAM-INF:BANDWIDTH=1500000,RESOLUTION=842x480,CODECS="avc1.4d001f,mp4a.40.2",AUDIO="audio"`, 1)
+	want = strings.Replace(want, "playlist_720.m3u8\n", "playlist_720.m3u8\n#EXT-X-STREAM-INF:BANDWIDTH=5000000\nplaylist_1080.m3u8\n", 1)
+
+	output, err := manifest.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(output) != want {
+		t.Errorf("got\n%s\nwant\n%s", output, want)
+	}
+}
+
+func TestLosslessModifiedCollections(t *testing.T) {
+	media := `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-DATERANGE:ID="ad1",START-DATE="2020-01-01T00:00:00Z",DURATION=30.0
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T00:00:00Z
+#EXTINF:4,
+segment1.ts
+#EXT-X-DATERANGE:ID="ad2",START-DATE="2020-01-01T00:00:04Z"
+#EXTINF:4,
+segment2.ts
+#EXT-X-RENDITION-REPORT:URI="low.m3u8",LAST-MSN=1,LAST-PART=2
+`
+	multivariant := `#EXTM3U
+#EXT-X-SESSION-DATA:VALUE="Title",DATA-ID="com.example.title"
+#EXT-X-MEDIA:TYPE=AUDIO,NAME="English",GROUP-ID="aac",LANGUAGE="en",DEFAULT=YES,URI="en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,NAME="Spanish",GROUP-ID="aac",LANGUAGE="es",URI="es.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=800000,AUDIO="aac"
+low.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=200000,URI="iframe.m3u8"
+`
+
+	tests := []struct {
+		name     string
+		playlist string
+		edit     func(m *Manifest)
+		want     string
+	}{
+		{
+			"remove date ranges",
+			media,
+			func(m *Manifest) { m.DateRanges = nil },
+			strings.NewReplacer(
+				"#EXT-X-DATERANGE:ID=\"ad1\",START-DATE=\"2020-01-01T00:00:00Z\",DURATION=30.0\n", "",
+				"#EXT-X-DATERANGE:ID=\"ad2\",START-DATE=\"2020-01-01T00:00:04Z\"\n", "",
+			).Replace(media),
+		},
+		{
+			"modify date range and rendition report",
+			media,
+			func(m *Manifest) {
+				m.DateRanges[1].Class = "com.example.ad"
+				m.RenditionReports[0].LastMSN = 2
+			},
+			strings.NewReplacer(
+				`#EXT-X-DATERANGE:ID="ad2",START-DATE="2020-01-01T00:00:04Z"`,
+				`#EXT-X-DATERANGE:ID="ad2",START-DATE="2020-01-01T00:00:04.000Z",CLASS="com.example.ad"`,
+				"LAST-MSN=1", "LAST-MSN=2",
+			).Replace(media),
+		},
+		{
+			"add date range and rendition report",
+			media,
+			func(m *Manifest) {
+				m.DateRanges = append(m.DateRanges, &DateRange{ID: "ad3", StartDate: time.Date(2020, 1, 1, 0, 0, 8, 0, time.UTC)})
+				m.RenditionReports = append(m.RenditionReports, &RenditionReport{URI: "high.m3u8", LastMSN: 1, LastPart: -1})
+			},
+			strings.NewReplacer(
+				"#EXT-X-PROGRAM-DATE-TIME",
+				"#EXT-X-DATERANGE:ID=\"ad3\",START-DATE=\"2020-01-01T00:00:08.000Z\"\n#EXT-X-PROGRAM-DATE-TIME",
+				"segment2.ts\n",
+				"segment2.ts\n#EXT-X-RENDITION-REPORT:URI=\"high.m3u8\",LAST-MSN=1\n",
+			).Replace(media),
+		},
+		{
+			"modify session data and rendition",
+			multivariant,
+			func(m *Manifest) {
+				m.SessionData[0].Value = "Other title"
+				m.MediaGroups["AUDIO"]["aac"]["English"].Default = false
+				m.MediaGroups["AUDIO"]["aac"]["Spanish"].Default = true
+			},
+			strings.NewReplacer(
+				`VALUE="Title"`, `VALUE="Other title"`,
+				`LANGUAGE="en",DEFAULT=YES,URI="en.m3u8"`, `LANGUAGE="en",URI="en.m3u8"`,
+				`LANGUAGE="es",URI="es.m3u8"`, `LANGUAGE="es",URI="es.m3u8",DEFAULT=YES`,
+			).Replace(multivariant),
+		},
+		{
+			"remove rendition and i-frame playlist",
+			multivariant,
+			func(m *Manifest) {
+				delete(m.MediaGroups["AUDIO"]["aac"], "Spanish")
+				m.IFramePlaylists = nil
+			},
+			strings.NewReplacer(
+				"#EXT-X-MEDIA:TYPE=AUDIO,NAME=\"Spanish\",GROUP-ID=\"aac\",LANGUAGE=\"es\",URI=\"es.m3u8\"\n", "",
+				"#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=200000,URI=\"iframe.m3u8\"\n", "",
+			).Replace(multivariant),
+		},
+	}
+
+	for _, test := range tests {
+		manifest := parseString(t, test.playlist, WithLossless())
+		test.edit(manifest)
+
+		output, err := manifest.Marshal()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(output) != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, output, test.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parsestream"
+)
+
+// Option configures New and Parse
+type Option func(*options)
+
+// options are the settings of a parser
+type options struct {
+	uri             string
+	mainDefinitions map[string]string
+	lossless        bool
+	strict          bool
+	customParsers   []parsestream.CustomParser
+	tagMappers      []parsestream.TagMapper
+	logger          *slog.Logger
+	// maxSize and maxLineLength are only used by Parse
+	maxSize       int64
+	maxLineLength int
+}
+
+// WithURI sets the URI of the playlist, against which relative URIs are
+// resolved and whose query parameters are available to #EXT-X-DEFINE
+// QUERYPARAM
+func WithURI(uri string) Option {
+	return func(o *options) {
+		o.uri = uri
+	}
+}
+
+// WithMainDefinitions sets the variables defined by the multivariant
+// playlist, which a media playlist imports with #EXT-X-DEFINE IMPORT
+func WithMainDefinitions(definitions map[string]string) Option {
+	return func(o *options) {
+		o.mainDefinitions = definitions
+	}
+}
+
+// WithLossless retains every input line so that Manifest.Marshal reproduces
+// the input byte for byte
+func WithLossless() Option {
+	return func(o *options) {
+		o.lossless = true
+	}
+}
+
+// WithStrict reports every malformed tag, attribute value and number as a
+// ParseError returned by End or Parse
+func WithStrict() Option {
+	return func(o *options) {
+		o.strict = true
+	}
+}
+
+// WithCustomParser adds a parser for non-standard tags, like AddParser
+func WithCustomParser(customParser parsestream.CustomParser) Option {
+	return func(o *options) {
+		o.customParsers = append(o.customParsers, customParser)
+	}
+}
+
+// WithTagMapper adds a mapper that rewrites non-standard tags, like
+// AddTagMapper
+func WithTagMapper(tagMapper parsestream.TagMapper) Option {
+	return func(o *options) {
+		o.tagMappers = append(o.tagMappers, tagMapper)
+	}
+}
+
+// WithLogger logs the warn events of the parser at level WARN and its info
+// events at level INFO
+func WithLogger(logger *slog.Logger) Option {
+	return func(o *options) {
+		o.logger = logger
+	}
+}
+
+// WithMaxSize sets the largest playlist in bytes that Parse reads. A size of
+// 0 or less disables the limit. New ignores it.
+func WithMaxSize(size int64) Option {
+	return func(o *options) {
+		o.maxSize = size
+	}
+}
+
+// WithMaxLineLength sets the longest line in bytes that Parse reads. A
+// length of 0 or less disables the limit. New ignores it.
+func WithMaxLineLength(length int) Option {
+	return func(o *options) {
+		o.maxLineLength = length
+	}
+}
+
+// mapOptions converts the options of NewParser to typed options. Options
+// whose keys are unknown or whose values have the wrong type are skipped and
+// reported by the returned error.
+func mapOptions(opts map[string]interface{}) ([]Option, error) {
+	var typed []Option
+	var errs []error
+	invalid := func(name string, value interface{}) {
+		errs = append(errs, fmt.Errorf("parser option %q has a value of the wrong type %T", name, value))
+	}
+
+	for _, name := range sortedKeys(opts) {
+		value := opts[name]
+		switch name {
+		case "uri":
+			uri, ok := value.(string)
+			if !ok {
+				invalid(name, value)
+				continue
+			}
+			typed = append(typed, WithURI(uri))
+
+		case "mainDefinitions":
+			definitions, ok := stringMap(value)
+			if !ok {
+				invalid(name, value)
+				continue
+			}
+			typed = append(typed, WithMainDefinitions(definitions))
+
+		case "lossless", "strict":
+			enabled, ok := value.(bool)
+			if !ok {
+				invalid(name, value)
+				continue
+			}
+			if enabled && name == "lossless" {
+				typed = append(typed, WithLossless())
+			} else if enabled {
+				typed = append(typed, WithStrict())
+			}
+
+		default:
+			errs = append(errs, fmt.Errorf("parser option %q is unknown", name))
+		}
+	}
+	return typed, errors.Join(errs...)
+}
+
+// stringMap converts a map of strings, which may be typed as
+// map[string]interface{} as when decoded from JSON
+func stringMap(value interface{}) (map[string]string, bool) {
+	switch value := value.(type) {
+	case map[string]string:
+		return value, true
+	case map[string]interface{}:
+		converted := make(map[string]string, len(value))
+		for k, v := range value {
+			s, ok := v.(string)
+			if !ok {
+				return nil, false
+			}
+			converted[k] = s
+		}
+		return converted, true
+	}
+	return nil, false
+}
+
+// customParserFromMap converts the options of AddParser to a custom parser
+func customParserFromMap(options map[string]interface{}) parsestream.CustomParser {
+	customParser := parsestream.CustomParser{}
+
+	if expr, ok := options["expression"].(*regexp.Regexp); ok {
+		customParser.Expression = expr
+	}
+
+	if customType, ok := options["customType"].(string); ok {
+		customParser.CustomType = customType
+	}
+
+	if dataParser, ok := options["dataParser"].(func(string) string); ok {
+		customParser.DataParser = dataParser
+	}
+
+	if segment, ok := options["segment"].(bool); ok {
+		customParser.Segment = segment
+	}
+
+	return customParser
+}
+
+// tagMapperFromMap converts the options of AddTagMapper to a tag mapper
+func tagMapperFromMap(options map[string]interface{}) parsestream.TagMapper {
+	tagMapper := parsestream.TagMapper{}
+
+	if expr, ok := options["expression"].(*regexp.Regexp); ok {
+		tagMapper.Expression = expr
+	}
+
+	if mapFunc, ok := options["map"].(func(string) string); ok {
+		tagMapper.Map = mapFunc
+	}
+
+	return tagMapper
+}
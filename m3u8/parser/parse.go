@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultMaxSize is the largest playlist in bytes that Parse reads unless
+// WithMaxSize sets another limit
+const DefaultMaxSize = 16 << 20
+
+// DefaultMaxLineLength is the longest line in bytes that Parse reads unless
+// WithMaxLineLength sets another limit
+const DefaultMaxLineLength = 1 << 20
+
+// readSize is the number of bytes Parse reads and parses at a time, which
+// bounds the work done between two checks of the context
+const readSize = 32 << 10
+
+var (
+	// ErrTooLarge is returned by Parse for playlists larger than the maximum size
+	ErrTooLarge = errors.New("playlist too large")
+	// ErrLineTooLong is returned by Parse for lines longer than the maximum
+	// line length
+	ErrLineTooLong = errors.New("playlist line too long")
+)
+
+// Parse reads a playlist from r and returns its manifest. It reads and parses
+// the input in chunks and stops with the error of ctx once ctx is done, and
+// with ErrTooLarge or ErrLineTooLong once the input exceeds the maximum size
+// or contains a line longer than the maximum line length. A Read that blocks
+// is not interrupted by ctx, so readers such as HTTP response bodies should be
+// bound to the same context.
+func Parse(ctx context.Context, r io.Reader, opts ...Option) (*Manifest, error) {
+	o := options{maxSize: DefaultMaxSize, maxLineLength: DefaultMaxLineLength}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	p := New(opts...)
+	buf := make([]byte, readSize)
+	var size int64
+	// lineLength is the length of the line that has not ended yet
+	lineLength := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		n, err := r.Read(buf)
+		if n > 0 {
+			size += int64(n)
+			if o.maxSize > 0 && size > o.maxSize {
+				return nil, fmt.Errorf("%w: exceeds %d bytes", ErrTooLarge, o.maxSize)
+			}
+			var longest int
+			longest, lineLength = lineLengths(buf[:n], lineLength)
+			if o.maxLineLength > 0 && longest > o.maxLineLength {
+				return nil, fmt.Errorf("%w: exceeds %d bytes", ErrLineTooLong, o.maxLineLength)
+			}
+			p.Push(string(buf[:n]))
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := p.End(); err != nil {
+		return nil, err
+	}
+	return p.Manifest, nil
+}
+
+// lineLengths returns the length of the longest line in chunk, including the
+// part of the first line read before it, and the length of its last line,
+// which continues in the next chunk
+func lineLengths(chunk []byte, lineLength int) (int, int) {
+	longest := 0
+	for {
+		i := bytes.IndexByte(chunk, '\n')
+		if i < 0 {
+			lineLength += len(chunk)
+			return max(longest, lineLength), lineLength
+		}
+		longest = max(longest, lineLength+i)
+		lineLength = 0
+		chunk = chunk[i+1:]
+	}
+}
@@ -0,0 +1,76 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestParse(t *testing.T) {
+	for _, name := range fixtures {
+		input := readFixture(t, name)
+		want := parseString(t, input)
+
+		got, err := Parse(context.Background(), iotest.HalfReader(strings.NewReader(input)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: the manifest differs from the one of Push", name)
+		}
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	longLine := "#EXTM3U\n#" + strings.Repeat("x", 999) + "\n#EXT-X-ENDLIST\n"
+
+	tests := []struct {
+		name  string
+		input string
+		opts  []Option
+		want  error
+	}{
+		{"size", longLine, []Option{WithMaxSize(100)}, ErrTooLarge},
+		{"size disabled", longLine, []Option{WithMaxSize(0)}, nil},
+		{"line length", longLine, []Option{WithMaxLineLength(999)}, ErrLineTooLong},
+		{"line length reached", longLine, []Option{WithMaxLineLength(1000)}, nil},
+		{"unterminated line", "#EXTM3U\n#EXT-X-ENDLIST", []Option{WithMaxLineLength(10)}, ErrLineTooLong},
+		{"line length disabled", longLine, []Option{WithMaxLineLength(0)}, nil},
+	}
+
+	for _, test := range tests {
+		// reading byte by byte spreads the long line over many chunks
+		_, err := Parse(context.Background(), iotest.OneByteReader(strings.NewReader(test.input)), test.opts...)
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got error %v, want %v", test.name, err, test.want)
+		}
+	}
+}
+
+func TestParseContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := Parse(ctx, strings.NewReader(readFixture(t, "sample.m3u8")))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestParseLongLineInChunks(t *testing.T) {
+	// a URI line of 4 MiB pushed in chunks of 1 byte
+	uri := strings.Repeat("a", 4<<20)
+	input := "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\n" + uri + "\n#EXT-X-ENDLIST\n"
+
+	manifest, err := Parse(context.Background(), iotest.OneByteReader(strings.NewReader(input)), WithMaxLineLength(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Segments) != 1 || manifest.Segments[0].URI != uri {
+		t.Error("the long URI was not parsed")
+	}
+}
@@ -19,32 +19,137 @@ type Segment struct {
 	Title           string
 	Byterange       *parsestream.Byterange
 	Map             *Map
-	Key             *Key
+	Key             *Key // first entry of Keys
+	Keys            []*Key
 	Timeline        int
 	Discontinuity   bool
+	Gap             bool
+	Bitrate         int // kbit/s from the most recent #EXT-X-BITRATE tag
 	DateTimeString  string
 	DateTimeObject  time.Time
 	ProgramDateTime int64
 	CueOut          string
 	CueOutCont      string
 	CueIn           string
-	Parts           []map[string]interface{}
-	PreloadHints    []map[string]interface{}
+	Parts           []*Part
+	PreloadHints    []*PreloadHint
 	Attributes      map[string]string
+	// Lines are the input lines of the segment or variant stream in lossless mode
+	Lines []*Line
+
+	// before is the state declared by the segments before this one and
+	// canonical the segment as it was written when parsed in lossless mode
+	before    segmentState
+	canonical string
+	// position orders the segments and variant streams read in lossless mode
+	position int
+	// zeroDuration is set if Duration replaces an #EXTINF duration of zero
+	zeroDuration bool
+}
+
+// zeroDurationPlaceholder is the duration of segments whose #EXTINF
+// duration is zero
+const zeroDurationPlaceholder = 0.01
+
+// hasZeroDuration returns true if the segment was read with an #EXTINF
+// duration of zero that has not been modified since
+func (s *Segment) hasZeroDuration() bool {
+	return s.zeroDuration && s.Duration == zeroDurationPlaceholder
 }
 
 // Map represents initialization segment information
 type Map struct {
 	URI       string
 	Byterange *parsestream.Byterange
-	Key       *Key
+	Key       *Key // first entry of Keys
+	Keys      []*Key
+}
+
+// Part represents a partial segment declared by #EXT-X-PART
+type Part struct {
+	URI         string
+	Duration    float64
+	Independent bool
+	Gap         bool
+	// Byterange is nil when the part is a whole resource. A missing offset
+	// is set to the end of the previous part.
+	Byterange *parsestream.Byterange
+}
+
+// ServerControl represents the delivery directives supported by the server,
+// declared by #EXT-X-SERVER-CONTROL. Durations are in seconds and 0 when not
+// declared.
+type ServerControl struct {
+	// CanSkipUntil is the skip boundary of playlist delta updates
+	CanSkipUntil      float64
+	CanSkipDateRanges bool
+	HoldBack          float64
+	PartHoldBack      float64
+	CanBlockReload    bool
+}
+
+// PartInf represents the information about partial segments declared by
+// #EXT-X-PART-INF
+type PartInf struct {
+	// PartTarget is the part target duration in seconds
+	PartTarget float64
+}
+
+// Skip represents the segments replaced by #EXT-X-SKIP in a playlist delta
+// update
+type Skip struct {
+	SkippedSegments int
+	// RecentlyRemovedDateRanges are the IDs of the date ranges removed from
+	// the playlist. It is nil unless the update skipped date ranges.
+	RecentlyRemovedDateRanges []string
+}
+
+// PreloadHint represents a resource announced by #EXT-X-PRELOAD-HINT
+// before it is available
+type PreloadHint struct {
+	// Type is either PART or MAP
+	Type string
+	URI  string
+	// Byterange is nil when the hint covers the whole resource. A zero
+	// Length means the hint extends to the end of the resource.
+	Byterange *parsestream.Byterange
 }
 
+// RenditionReport represents the state of another rendition as reported
+// by #EXT-X-RENDITION-REPORT
+type RenditionReport struct {
+	// URI is the rendition URI as it appears in the playlist
+	URI string
+	// ResolvedURI is URI resolved against the URI of the reporting playlist
+	ResolvedURI string
+	LastMSN     int
+	// LastPart is -1 when the report does not include LAST-PART
+	LastPart int
+}
+
+// DefaultKeyFormat is the KEYFORMAT of keys that do not declare one
+const DefaultKeyFormat = "identity"
+
 // Key represents encryption information
 type Key struct {
-	Method string
+	Method EncryptionMethod
 	URI    string
-	IV     string
+	// IV is the IV attribute as written, e.g. 0x0F91DC05...; IVBytes
+	// decodes it
+	IV                string
+	KeyFormat         string
+	KeyFormatVersions []int
+}
+
+// SessionData represents arbitrary session data declared by #EXT-X-SESSION-DATA
+type SessionData struct {
+	DataID string
+	// Value and URI are mutually exclusive
+	Value string
+	URI   string
+	// Format is the format of the data referenced by URI, either JSON or RAW
+	Format   string
+	Language string
 }
 
 // Start represents a start point for the manifest
@@ -68,11 +173,11 @@ type DateRange struct {
 	CustomAttributes map[string]interface{}
 }
 
-// IFramePlaylist represents an iFrame playlist
+// IFramePlaylist represents an iFrame playlist. Its variant has no
+// FrameRate and no AUDIO, SUBTITLES or CLOSED-CAPTIONS groups.
 type IFramePlaylist struct {
-	URI        string
-	Attributes map[string]string
-	Timeline   int
+	Variant
+	Timeline int
 }
 
 // MediaGroup represents a media group
@@ -84,6 +189,17 @@ type MediaGroup struct {
 	InstreamID      string
 	Characteristics string
 	Forced          bool
+	// StableRenditionID identifies the rendition across pathways and
+	// playlist reloads, e.g. in the PER-RENDITION-URIS of content steering
+	StableRenditionID string
+}
+
+// ContentSteering represents the content steering server declared by
+// #EXT-X-CONTENT-STEERING
+type ContentSteering struct {
+	ServerURI string
+	// PathwayID is the pathway to use until the steering manifest is loaded
+	PathwayID string
 }
 
 // Manifest represents a parsed M3U8 manifest
@@ -105,20 +221,35 @@ type Manifest struct {
 	Start               *Start
 	DtsCptOffset        float64
 
-	Skip                map[string]interface{}
-	ServerControl       map[string]interface{}
-	PartInf             map[string]interface{}
+	Skip                *Skip
+	ServerControl       *ServerControl
+	PartInf             *PartInf
 	PartTargetDuration  float64
-	RenditionReports    []map[string]interface{}
-	Playlists           []*Segment
+	RenditionReports    []*RenditionReport
+	Playlists           []*Variant
 	IFramePlaylists     []*IFramePlaylist
 	DiscontinuityStarts []int
 	DateRanges          []*DateRange
 	ContentProtection   map[string]interface{}
-	ContentSteering     map[string]interface{}
+	ContentSteering     *ContentSteering
 	MediaGroups         map[string]map[string]map[string]*MediaGroup
 	Custom              map[string]interface{}
 	Definitions         map[string]string
+	SessionData         []*SessionData
+	SessionKeys         []*Key
+
+	// Lines are the input lines before the first segment or variant stream
+	// and TrailingLines those after the last one, retained in lossless mode.
+	// Marshal writes the retained lines when Lines is not nil.
+	Lines         []*Line
+	TrailingLines []*Line
+
+	// canonical holds the tags that occur at most once per playlist and
+	// canonicalEntries the entries of the collections as they were written
+	// when parsed in lossless mode
+	canonical        map[string]string
+	canonicalEntries map[entryKey]string
+	noFinalNewline   bool
 }
 
 // Parser represents an M3U8 parser
@@ -131,10 +262,43 @@ type Parser struct {
 	MainDefinitions     map[string]string
 	Params              url.Values
 	LastProgramDateTime int64
+	// Lossless retains every input line so that Manifest.Marshal reproduces
+	// the input byte for byte unless the manifest is modified
+	Lossless bool
+	// Strict reports every malformed tag, attribute value and number as a
+	// ParseError returned by End
+	Strict bool
+
+	lines  *lineRecorder
+	strict *strictChecker
 }
 
-// NewParser creates a new Parser instance
+// NewParser creates a new Parser instance from options keyed by name:
+// "uri" (a string), "mainDefinitions" (a map of strings, either a
+// map[string]string or a map[string]interface{} as decoded from JSON),
+// "lossless" and "strict" (bools). Options with unknown keys or values of
+// the wrong type are skipped; NewParserChecked reports them. New takes the
+// same options typed.
 func NewParser(opts map[string]interface{}) *Parser {
+	typed, _ := mapOptions(opts)
+	return New(typed...)
+}
+
+// NewParserChecked is like NewParser, but returns an error that names every
+// option with an unknown key or a value of the wrong type. The parser is
+// created from the remaining options even then.
+func NewParserChecked(opts map[string]interface{}) (*Parser, error) {
+	typed, err := mapOptions(opts)
+	return New(typed...), err
+}
+
+// New creates a new Parser instance configured by opts
+func New(opts ...Option) *Parser {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	p := &Parser{
 		Stream:              stream.NewStream(),
 		LineStream:          linestream.NewLineStream(),
@@ -143,16 +307,43 @@ func NewParser(opts map[string]interface{}) *Parser {
 		LastProgramDateTime: 0,
 	}
 
-	if uri, ok := opts["uri"].(string); ok {
-		p.URI = uri
-		parsedURL, err := url.Parse(uri)
+	if o.uri != "" {
+		p.URI = o.uri
+		parsedURL, err := url.Parse(o.uri)
 		if err == nil {
 			p.Params = parsedURL.Query()
 		}
 	}
 
-	if mainDefs, ok := opts["mainDefinitions"].(map[string]string); ok {
-		p.MainDefinitions = mainDefs
+	if o.mainDefinitions != nil {
+		p.MainDefinitions = o.mainDefinitions
+	}
+
+	if o.lossless {
+		p.Lossless = true
+		p.lines = &lineRecorder{}
+	}
+
+	if o.strict {
+		p.Strict = true
+		p.strict = &strictChecker{}
+	}
+
+	for _, customParser := range o.customParsers {
+		p.ParseStream.AddParser(customParser)
+	}
+	for _, tagMapper := range o.tagMappers {
+		p.ParseStream.AddTagMapper(tagMapper)
+	}
+
+	if o.logger != nil {
+		logger := o.logger
+		p.On("warn", func(data interface{}) {
+			logger.Warn(eventMessage(data))
+		})
+		p.On("info", func(data interface{}) {
+			logger.Info(eventMessage(data))
+		})
 	}
 
 	p.Manifest = &Manifest{
@@ -174,14 +365,18 @@ func NewParser(opts map[string]interface{}) *Parser {
 	uris := []*Segment{}
 	var currentUri *Segment = &Segment{}
 	var currentMap *Map
-	var key *Key
+	var keys []*Key
+	bitrate := 0
+	// bitrateSeen is set by the first #EXT-X-BITRATE tag, which distinguishes
+	// an explicit #EXT-X-BITRATE:0 from the absence of the tag
+	bitrateSeen := false
 	currentTimeline := 0
 	lastByterangeEnd := 0
 	lastPartByterangeEnd := 0
 
 	// Variables for tracking variant playlists
 	expectPlaylistURI := false
-	var pendingPlaylist *Segment
+	var pendingPlaylist *Variant
 
 	p.On("end", func(data interface{}) {
 		// only add preloadSegment if we don't yet have a uri for it
@@ -194,14 +389,19 @@ func NewParser(opts map[string]interface{}) *Parser {
 			currentUri.Map = currentMap
 		}
 
-		if currentUri.Key == nil && key != nil {
-			currentUri.Key = key
+		if currentUri.Keys == nil && keys != nil {
+			currentUri.Keys = keys
+			currentUri.Key = keys[0]
 		}
 
 		if currentUri.Timeline == 0 && currentTimeline != 0 {
 			currentUri.Timeline = currentTimeline
 		}
 
+		if bitrateSeen {
+			currentUri.Bitrate = bitrate
+		}
+
 		p.Manifest.PreloadSegment = currentUri
 	})
 
@@ -223,20 +423,25 @@ func NewParser(opts map[string]interface{}) *Parser {
 			return
 		}
 
-		// Replace variables in uris and attributes as defined in #EXT-X-DEFINE tags
-		if p.Manifest.Definitions != nil {
-			if entryType == "uri" && entry["uri"] != nil {
-				uri := entry["uri"].(string)
-				for def, val := range p.Manifest.Definitions {
-					uri = strings.Replace(uri, "{$"+def+"}", val, -1)
-				}
-				entry["uri"] = uri
+		if p.lines != nil {
+			switch entryType {
+			case "tag":
+				tagType, _ := entry["tagType"].(string)
+				p.lines.classify(tagType)
+			default:
+				p.lines.classify(entryType)
+			}
+		}
+
+		// Replace variables in uris and attributes as defined in #EXT-X-DEFINE tags.
+		// The attributes of #EXT-X-DEFINE itself are taken literally.
+		if entry["tagType"] != "define" {
+			if uri, ok := entry["uri"].(string); ok {
+				entry["uri"] = p.substituteVariables(uri)
 			}
 			if attrs, ok := entry["attributes"].(map[string]string); ok {
 				for attrKey, attrVal := range attrs {
-					for def, val := range p.Manifest.Definitions {
-						attrs[attrKey] = strings.Replace(attrVal, "{$"+def+"}", val, -1)
-					}
+					attrs[attrKey] = p.substituteVariables(attrVal)
 				}
 			}
 		}
@@ -305,7 +510,8 @@ func NewParser(opts map[string]interface{}) *Parser {
 				}
 
 				if duration, ok := entry["duration"].(float64); ok && duration == 0 {
-					currentUri.Duration = 0.01
+					currentUri.Duration = zeroDurationPlaceholder
+					currentUri.zeroDuration = true
 					p.Trigger("info", map[string]interface{}{
 						"message": "updating zero segment duration to a small value",
 					})
@@ -322,9 +528,9 @@ func NewParser(opts map[string]interface{}) *Parser {
 					return
 				}
 
-				// clear the active encryption key
+				// clear the active encryption keys of all key formats
 				if method, ok := attrs["METHOD"]; ok && method == "NONE" {
-					key = nil
+					keys = nil
 					return
 				}
 
@@ -335,18 +541,109 @@ func NewParser(opts map[string]interface{}) *Parser {
 					return
 				}
 
-				// setup an encryption key for upcoming segments
-				key = &Key{
-					Method: "AES-128",
-					URI:    attrs["URI"],
+				// setup an encryption key for upcoming segments, replacing
+				// the active key of the same key format
+				key := keyFromAttributes(attrs)
+				if err := key.Validate(); err != nil {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "#EXT-X-KEY " + err.Error(),
+					})
+				}
+				// sample encryption is usually paired with a DRM system, which
+				// the key format identifies
+				if _, ok := attrs["KEYFORMAT"]; !ok && key.Method.IsSampleEncryption() {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "#EXT-X-KEY with METHOD=" + string(key.Method) + " lacks KEYFORMAT",
+					})
+				}
+				updated := make([]*Key, 0, len(keys)+1)
+				replaced := false
+				for _, active := range keys {
+					if active.KeyFormat == key.KeyFormat {
+						updated = append(updated, key)
+						replaced = true
+					} else {
+						updated = append(updated, active)
+					}
+				}
+				if !replaced {
+					updated = append(updated, key)
+				}
+				keys = updated
+
+			case "session-key":
+				attrs, ok := entry["attributes"].(map[string]string)
+				if !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "ignoring session-key declaration without attribute list",
+					})
+					return
+				}
+
+				method, ok := attrs["METHOD"]
+				if !ok || method == "NONE" {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "#EXT-X-SESSION-KEY ignoring declaration without METHOD or with METHOD=NONE",
+					})
+					return
 				}
 
-				if method, ok := attrs["METHOD"]; ok {
-					key.Method = method
+				if _, ok := attrs["URI"]; !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "ignoring session-key declaration without URI",
+					})
+					return
 				}
 
-				if iv, ok := attrs["IV"]; ok {
-					key.IV = iv
+				sessionKey := keyFromAttributes(attrs)
+				p.Manifest.SessionKeys = append(p.Manifest.SessionKeys, sessionKey)
+				if p.lines != nil {
+					p.lines.attach(sessionKey)
+				}
+
+			case "session-data":
+				attrs, ok := entry["attributes"].(map[string]string)
+				if !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "ignoring session-data without attributes",
+					})
+					return
+				}
+
+				dataID, ok := attrs["DATA-ID"]
+				if !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "#EXT-X-SESSION-DATA lacks required attribute DATA-ID",
+					})
+					return
+				}
+
+				value, hasValue := attrs["VALUE"]
+				uri, hasURI := attrs["URI"]
+				if hasValue == hasURI {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "#EXT-X-SESSION-DATA " + dataID + " must contain either VALUE or URI",
+					})
+					return
+				}
+
+				sessionData := &SessionData{
+					DataID:   dataID,
+					Value:    value,
+					URI:      uri,
+					Language: attrs["LANGUAGE"],
+				}
+
+				if hasURI {
+					sessionData.Format = "JSON"
+					if format, ok := attrs["FORMAT"]; ok {
+						sessionData.Format = format
+					}
+				}
+
+				p.Manifest.SessionData = append(p.Manifest.SessionData, sessionData)
+				if p.lines != nil {
+					p.lines.attach(sessionData)
 				}
 
 			case "media-sequence":
@@ -373,8 +670,9 @@ func NewParser(opts map[string]interface{}) *Parser {
 				if byterange, ok := entry["byterange"].(parsestream.Byterange); ok {
 					currentMap.Byterange = &byterange
 				}
-				if key != nil {
-					currentMap.Key = key
+				if keys != nil {
+					currentMap.Keys = keys
+					currentMap.Key = keys[0]
 				}
 
 			case "stream-inf":
@@ -387,18 +685,11 @@ func NewParser(opts map[string]interface{}) *Parser {
 				}
 
 				// Create a new variant playlist entry with attributes
-				pendingPlaylist = &Segment{
-					Attributes: make(map[string]string),
-				}
-
-				// Copy all attributes to the playlist segment
-				for k, v := range attrsMap {
-					pendingPlaylist.Attributes[k] = v
-				}
+				pendingPlaylist = NewVariant("", attrsMap)
 
 				// Initialize playlists array if needed
 				if p.Manifest.Playlists == nil {
-					p.Manifest.Playlists = []*Segment{}
+					p.Manifest.Playlists = []*Variant{}
 				}
 
 				// Signal that the next URI belongs to this variant
@@ -409,6 +700,19 @@ func NewParser(opts map[string]interface{}) *Parser {
 				currentUri.Discontinuity = true
 				p.Manifest.DiscontinuityStarts = append(p.Manifest.DiscontinuityStarts, len(uris))
 
+			case "gap":
+				currentUri.Gap = true
+
+			case "bitrate":
+				if value, ok := entry["bitrate"].(int); ok {
+					bitrate = value
+					bitrateSeen = true
+				} else {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "ignoring bitrate without a value",
+					})
+				}
+
 			case "program-date-time":
 				if p.Manifest.DateTimeString == "" {
 					if dateTimeStr, ok := entry["dateTimeString"].(string); ok {
@@ -473,7 +777,7 @@ func NewParser(opts map[string]interface{}) *Parser {
 				}
 
 				if precise, ok := attrs["PRECISE"]; ok {
-					p.Manifest.Start.Precise = regexp.MustCompile(`YES`).MatchString(precise)
+					p.Manifest.Start.Precise = isYes(precise)
 				}
 
 			case "cue-out":
@@ -497,13 +801,138 @@ func NewParser(opts map[string]interface{}) *Parser {
 			case "i-frames-only":
 				p.Manifest.IFramesOnly = true
 
+			case "content-steering":
+				attrs, ok := entry["attributes"].(map[string]string)
+				if !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "ignoring content-steering without attributes",
+					})
+					return
+				}
+
+				serverURI, ok := attrs["SERVER-URI"]
+				if !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "#EXT-X-CONTENT-STEERING lacks required attribute SERVER-URI",
+					})
+					return
+				}
+
+				p.Manifest.ContentSteering = &ContentSteering{
+					ServerURI: serverURI,
+					PathwayID: attrs["PATHWAY-ID"],
+				}
+
+			case "define":
+				attrs, ok := entry["attributes"].(map[string]string)
+				if !ok {
+					attrs = map[string]string{}
+				}
+
+				if p.Manifest.Definitions == nil {
+					p.Manifest.Definitions = make(map[string]string)
+				}
+
+				addDefinition := func(name, value string) {
+					if _, exists := p.Manifest.Definitions[name]; exists {
+						p.Trigger("warn", map[string]interface{}{
+							"message": "#EXT-X-DEFINE ignoring duplicate name " + name,
+						})
+						return
+					}
+					p.Manifest.Definitions[name] = value
+				}
+
+				_, hasName := attrs["NAME"]
+				_, hasImport := attrs["IMPORT"]
+
+				if queryParam, ok := attrs["QUERYPARAM"]; ok {
+					if hasName || hasImport {
+						p.Trigger("warn", map[string]interface{}{
+							"message": "#EXT-X-DEFINE ignoring QUERYPARAM combined with NAME or IMPORT",
+						})
+						return
+					}
+
+					if _, ok := p.Params[queryParam]; !ok {
+						p.Trigger("warn", map[string]interface{}{
+							"message": "#EXT-X-DEFINE ignoring QUERYPARAM " + queryParam + " which is not present in the playlist URI",
+						})
+						return
+					}
+
+					addDefinition(queryParam, p.Params.Get(queryParam))
+					return
+				}
+
+				if name, ok := attrs["NAME"]; ok {
+					if hasImport {
+						p.Trigger("warn", map[string]interface{}{
+							"message": "#EXT-X-DEFINE ignoring NAME combined with IMPORT",
+						})
+						return
+					}
+
+					value, ok := attrs["VALUE"]
+					if !ok {
+						p.Trigger("warn", map[string]interface{}{
+							"message": "#EXT-X-DEFINE ignoring NAME " + name + " without VALUE",
+						})
+						return
+					}
+
+					addDefinition(name, value)
+					return
+				}
+
+				if importName, ok := attrs["IMPORT"]; ok {
+					value, ok := p.MainDefinitions[importName]
+					if !ok {
+						p.Trigger("warn", map[string]interface{}{
+							"message": "#EXT-X-DEFINE ignoring IMPORT " + importName + " which is not defined by the multivariant playlist",
+						})
+						return
+					}
+
+					addDefinition(importName, value)
+					return
+				}
+
+				p.Trigger("warn", map[string]interface{}{
+					"message": "#EXT-X-DEFINE ignoring declaration without NAME, IMPORT or QUERYPARAM",
+				})
+
+			case "skip":
+				attrs, ok := entry["attributes"].(map[string]string)
+				if !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "ignoring skip without attributes",
+					})
+					return
+				}
+
+				p.Manifest.Skip = &Skip{}
+				p.Manifest.Skip.SkippedSegments, _ = strconv.Atoi(attrs["SKIPPED-SEGMENTS"])
+
+				if removed, ok := attrs["RECENTLY-REMOVED-DATERANGES"]; ok {
+					p.Manifest.Skip.RecentlyRemovedDateRanges = strings.Split(removed, parsestream.TAB)
+				}
+
+				if _, ok := attrs["SKIPPED-SEGMENTS"]; !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "#EXT-X-SKIP lacks required attribute SKIPPED-SEGMENTS",
+					})
+				}
+
 			case "part":
 				attrs, ok := entry["attributes"].(map[string]string)
 				if ok {
-					part := make(map[string]interface{})
-					for k, v := range attrs {
-						part[camelCase(k)] = v
+					part := &Part{
+						URI:         attrs["URI"],
+						Independent: isYes(attrs["INDEPENDENT"]),
+						Gap:         isYes(attrs["GAP"]),
 					}
+					part.Duration, _ = strconv.ParseFloat(attrs["DURATION"], 64)
 
 					if byterangeObj, ok := entry["byterange"].(parsestream.Byterange); ok {
 						byterange := parsestream.Byterange{
@@ -516,12 +945,114 @@ func NewParser(opts map[string]interface{}) *Parser {
 						}
 
 						lastPartByterangeEnd = byterange.Offset + byterange.Length
-						part["byterange"] = byterange
+						part.Byterange = &byterange
 					}
 
 					currentUri.Parts = append(currentUri.Parts, part)
 				}
 
+			case "preload-hint":
+				attrs, ok := entry["attributes"].(map[string]string)
+				if !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "ignoring preload-hint without attributes",
+					})
+					return
+				}
+
+				hintType, ok := attrs["TYPE"]
+				if !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "#EXT-X-PRELOAD-HINT lacks required attribute TYPE",
+					})
+					return
+				}
+
+				uri, ok := attrs["URI"]
+				if !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "#EXT-X-PRELOAD-HINT lacks required attribute URI",
+					})
+					return
+				}
+
+				hint := &PreloadHint{
+					Type: hintType,
+					URI:  uri,
+				}
+
+				start, hasStart := attrs["BYTERANGE-START"]
+				length, hasLength := attrs["BYTERANGE-LENGTH"]
+				if hasStart || hasLength {
+					hint.Byterange = &parsestream.Byterange{}
+					if hasLength {
+						hint.Byterange.Length, _ = strconv.Atoi(length)
+					}
+					if hasStart {
+						hint.Byterange.Offset, _ = strconv.Atoi(start)
+					}
+					if hintType == "PART" {
+						lastPartByterangeEnd = hint.Byterange.Offset + hint.Byterange.Length
+					}
+				}
+
+				for i, previous := range currentUri.PreloadHints {
+					if previous.Type == hintType {
+						p.Trigger("warn", map[string]interface{}{
+							"message": "#EXT-X-PRELOAD-HINT #" + strconv.Itoa(len(currentUri.PreloadHints)) +
+								" has the same TYPE " + hintType + " as preload hint #" + strconv.Itoa(i),
+						})
+					}
+				}
+
+				currentUri.PreloadHints = append(currentUri.PreloadHints, hint)
+
+			case "rendition-report":
+				attrs, ok := entry["attributes"].(map[string]string)
+				if !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "ignoring rendition-report without attributes",
+					})
+					return
+				}
+
+				index := strconv.Itoa(len(p.Manifest.RenditionReports))
+				required := []string{"URI", "LAST-MSN"}
+				if p.Manifest.PartInf != nil {
+					required = append(required, "LAST-PART")
+				}
+				for _, name := range required {
+					if _, ok := attrs[name]; !ok {
+						p.Trigger("warn", map[string]interface{}{
+							"message": "#EXT-X-RENDITION-REPORT #" + index + " lacks required attribute " + name,
+						})
+					}
+				}
+
+				uri, ok := attrs["URI"]
+				if !ok {
+					return
+				}
+
+				report := &RenditionReport{
+					URI:         uri,
+					ResolvedURI: ResolveURI(p.URI, uri),
+					LastPart:    -1,
+				}
+
+				if lastMSN, ok := attrs["LAST-MSN"]; ok {
+					report.LastMSN, _ = strconv.Atoi(lastMSN)
+				}
+
+				if lastPart, ok := attrs["LAST-PART"]; ok {
+					report.LastPart, _ = strconv.Atoi(lastPart)
+				}
+
+				p.Manifest.RenditionReports = append(p.Manifest.RenditionReports, report)
+				if p.lines != nil {
+					p.lines.attach(report)
+				}
+
 			case "i-frame-playlist":
 				attrs, ok := entry["attributes"].(map[string]string)
 				if !ok {
@@ -539,11 +1070,14 @@ func NewParser(opts map[string]interface{}) *Parser {
 					return
 				}
 
-				p.Manifest.IFramePlaylists = append(p.Manifest.IFramePlaylists, &IFramePlaylist{
-					URI:        uri,
-					Attributes: attrs,
-					Timeline:   currentTimeline,
-				})
+				iFramePlaylist := &IFramePlaylist{
+					Variant:  *NewVariant(uri, attrs),
+					Timeline: currentTimeline,
+				}
+				p.Manifest.IFramePlaylists = append(p.Manifest.IFramePlaylists, iFramePlaylist)
+				if p.lines != nil {
+					p.lines.attach(iFramePlaylist)
+				}
 
 			case "media":
 				attrs, ok := entry["attributes"].(map[string]string)
@@ -578,6 +1112,13 @@ func NewParser(opts map[string]interface{}) *Parser {
 					return
 				}
 
+				if _, ok := p.Manifest.MediaGroups[mediaType]; !ok {
+					p.Trigger("warn", map[string]interface{}{
+						"message": "ignoring media with unknown TYPE " + mediaType,
+					})
+					return
+				}
+
 				// Initialize the group if needed
 				if p.Manifest.MediaGroups[mediaType][groupID] == nil {
 					p.Manifest.MediaGroups[mediaType][groupID] = make(map[string]*MediaGroup)
@@ -585,8 +1126,8 @@ func NewParser(opts map[string]interface{}) *Parser {
 
 				// Create the media group rendition
 				rendition := &MediaGroup{
-					Default:    regexp.MustCompile(`yes`).MatchString(attrs["DEFAULT"]),
-					Autoselect: regexp.MustCompile(`yes`).MatchString(attrs["AUTOSELECT"]),
+					Default:    isYes(attrs["DEFAULT"]),
+					Autoselect: isYes(attrs["AUTOSELECT"]),
 				}
 
 				if language, ok := attrs["LANGUAGE"]; ok {
@@ -606,11 +1147,18 @@ func NewParser(opts map[string]interface{}) *Parser {
 				}
 
 				if forced, ok := attrs["FORCED"]; ok {
-					rendition.Forced = regexp.MustCompile(`yes`).MatchString(forced)
+					rendition.Forced = isYes(forced)
+				}
+
+				if stableRenditionID, ok := attrs["STABLE-RENDITION-ID"]; ok {
+					rendition.StableRenditionID = stableRenditionID
 				}
 
 				// Add the rendition to the media groups
 				p.Manifest.MediaGroups[mediaType][groupID][name] = rendition
+				if p.lines != nil {
+					p.lines.attach(renditionKey{mediaType, groupID, name})
+				}
 
 			case "daterange":
 				attrs, ok := entry["attributes"].(map[string]string)
@@ -668,7 +1216,7 @@ func NewParser(opts map[string]interface{}) *Parser {
 				}
 
 				if endOnNext, ok := attrs["END-ON-NEXT"]; ok {
-					dateRange.EndOnNext = regexp.MustCompile(`yes`).MatchString(endOnNext)
+					dateRange.EndOnNext = isYes(endOnNext)
 				}
 
 				if scte35CMD, ok := attrs["SCTE35-CMD"]; ok {
@@ -702,6 +1250,9 @@ func NewParser(opts map[string]interface{}) *Parser {
 				}
 
 				p.Manifest.DateRanges = append(p.Manifest.DateRanges, dateRange)
+				if p.lines != nil {
+					p.lines.attach(dateRange)
+				}
 
 			case "part-inf":
 				attrs, ok := entry["attributes"].(map[string]string)
@@ -712,10 +1263,9 @@ func NewParser(opts map[string]interface{}) *Parser {
 					return
 				}
 
-				p.Manifest.PartInf = camelCaseKeys(attrs)
-				if partTarget, ok := p.Manifest.PartInf["partTarget"].(float64); ok {
-					p.Manifest.PartTargetDuration = partTarget
-				}
+				p.Manifest.PartInf = &PartInf{}
+				p.Manifest.PartInf.PartTarget, _ = strconv.ParseFloat(attrs["PART-TARGET"], 64)
+				p.Manifest.PartTargetDuration = p.Manifest.PartInf.PartTarget
 
 			case "server-control":
 				attrs, ok := entry["attributes"].(map[string]string)
@@ -726,19 +1276,25 @@ func NewParser(opts map[string]interface{}) *Parser {
 					return
 				}
 
-				p.Manifest.ServerControl = camelCaseKeys(attrs)
+				serverControl := &ServerControl{
+					CanSkipDateRanges: isYes(attrs["CAN-SKIP-DATERANGES"]),
+					CanBlockReload:    isYes(attrs["CAN-BLOCK-RELOAD"]),
+				}
+				serverControl.CanSkipUntil, _ = strconv.ParseFloat(attrs["CAN-SKIP-UNTIL"], 64)
+				serverControl.HoldBack, _ = strconv.ParseFloat(attrs["HOLD-BACK"], 64)
+				serverControl.PartHoldBack, _ = strconv.ParseFloat(attrs["PART-HOLD-BACK"], 64)
+				p.Manifest.ServerControl = serverControl
 
 				// Add can-block-reload default if not specified
-				if _, ok := p.Manifest.ServerControl["canBlockReload"]; !ok {
-					p.Manifest.ServerControl["canBlockReload"] = false
+				if _, ok := attrs["CAN-BLOCK-RELOAD"]; !ok {
 					p.Trigger("info", map[string]interface{}{
 						"message": "#EXT-X-SERVER-CONTROL defaulting CAN-BLOCK-RELOAD to false",
 					})
 				}
 
 				// Validate CAN-SKIP-DATERANGES requires CAN-SKIP-UNTIL
-				if canSkipDateranges, ok := p.Manifest.ServerControl["canSkipDateranges"].(bool); ok && canSkipDateranges {
-					if _, ok := p.Manifest.ServerControl["canSkipUntil"]; !ok {
+				if serverControl.CanSkipDateRanges {
+					if _, ok := attrs["CAN-SKIP-UNTIL"]; !ok {
 						p.Trigger("warn", map[string]interface{}{
 							"message": "#EXT-X-SERVER-CONTROL lacks required attribute CAN-SKIP-UNTIL which is required when CAN-SKIP-DATERANGES is set",
 						})
@@ -752,12 +1308,21 @@ func NewParser(opts map[string]interface{}) *Parser {
 			if expectPlaylistURI {
 				// This URI is for a variant playlist
 				pendingPlaylist.URI = uri
+				if p.lines != nil {
+					pendingPlaylist.Lines = p.lines.take()
+					pendingPlaylist.position = p.lines.taken
+				}
 				p.Manifest.Playlists = append(p.Manifest.Playlists, pendingPlaylist)
 				expectPlaylistURI = false
 			} else {
 				// This is a normal segment URI
 				currentUri.URI = uri
+				if p.lines != nil {
+					currentUri.Lines = p.lines.take()
+					currentUri.position = p.lines.taken
+				}
 				uris = append(uris, currentUri)
+				p.Manifest.Segments = uris
 
 				// if no explicit duration was declared, use the target duration
 				if p.Manifest.TargetDuration != 0 && currentUri.Duration == 0 {
@@ -768,12 +1333,18 @@ func NewParser(opts map[string]interface{}) *Parser {
 				}
 
 				// annotate with encryption information, if necessary
-				if key != nil {
-					currentUri.Key = key
+				if keys != nil {
+					currentUri.Keys = keys
+					currentUri.Key = keys[0]
 				}
 
 				currentUri.Timeline = currentTimeline
 
+				// the most recent bitrate applies until it is changed
+				if bitrateSeen {
+					currentUri.Bitrate = bitrate
+				}
+
 				// annotate with initialization segment information, if necessary
 				if currentMap != nil {
 					currentUri.Map = currentMap
@@ -815,6 +1386,15 @@ func NewParser(opts map[string]interface{}) *Parser {
 
 	// Connect LineStream to ParseStream
 	p.LineStream.Stream.On("data", func(data interface{}) {
+		if dataMap, ok := data.(map[string]interface{}); ok {
+			line, _ := dataMap["data"].(string)
+			if p.lines != nil {
+				p.lines.add(line)
+			}
+			if p.strict != nil {
+				p.strict.check(line)
+			}
+		}
 		p.ParseStream.HandleData(data)
 	})
 
@@ -827,93 +1407,210 @@ func NewParser(opts map[string]interface{}) *Parser {
 
 // Push parses the input string and updates the manifest object
 func (p *Parser) Push(chunk string) {
+	if p.lines != nil && chunk != "" {
+		p.lines.endsWithNewline = strings.HasSuffix(chunk, "\n")
+	}
 	p.LineStream.Push(chunk)
 }
 
-// End flushes any remaining input
-func (p *Parser) End() {
+// End flushes any remaining input. In strict mode it returns the malformed
+// lines of the input as ParseErrors, or nil if there are none.
+func (p *Parser) End() error {
 	// flush any buffered input
+	if p.lines != nil {
+		p.lines.discard = p.lines.endsWithNewline
+	}
 	p.LineStream.Push("\n")
 	p.LastProgramDateTime = 0
 	p.Trigger("end", nil)
+
+	if p.lines != nil {
+		p.lines.finish(p.Manifest)
+	}
+
+	if p.strict != nil && len(p.strict.errors) > 0 {
+		return p.strict.errors
+	}
+	return nil
 }
 
-// AddParser adds an additional parser for non-standard tags
+// AddParser adds an additional parser for non-standard tags from options
+// keyed by name: "expression", "customType", "dataParser" and "segment"
 func (p *Parser) AddParser(options map[string]interface{}) {
-	// Convert options to the parsestream.CustomParser format
-	customParser := parsestream.CustomParser{}
+	p.ParseStream.AddParser(customParserFromMap(options))
+}
 
-	if expr, ok := options["expression"].(*regexp.Regexp); ok {
-		customParser.Expression = expr
-	}
+// AddTagMapper adds a custom header mapper from options keyed by name:
+// "expression" and "map"
+func (p *Parser) AddTagMapper(options map[string]interface{}) {
+	p.ParseStream.AddTagMapper(tagMapperFromMap(options))
+}
 
-	if customType, ok := options["customType"].(string); ok {
-		customParser.CustomType = customType
+// eventMessage returns the message of a warn or info event
+func eventMessage(data interface{}) string {
+	if event, ok := data.(map[string]interface{}); ok {
+		if message, ok := event["message"].(string); ok {
+			return message
+		}
 	}
+	return ""
+}
 
-	if dataParser, ok := options["dataParser"].(func(string) string); ok {
-		customParser.DataParser = dataParser
-	}
+// variableReference matches a {$NAME} variable reference as defined for #EXT-X-DEFINE
+var variableReference = regexp.MustCompile(`\{\$([a-zA-Z0-9_-]+)\}`)
 
-	if segment, ok := options["segment"].(bool); ok {
-		customParser.Segment = segment
+// substituteVariables replaces variable references in str with their values from
+// Manifest.Definitions, warning about any reference that has not been defined
+func (p *Parser) substituteVariables(str string) string {
+	if !strings.Contains(str, "{$") {
+		return str
 	}
 
-	p.ParseStream.AddParser(customParser)
+	return variableReference.ReplaceAllStringFunc(str, func(reference string) string {
+		name := variableReference.FindStringSubmatch(reference)[1]
+		if value, ok := p.Manifest.Definitions[name]; ok {
+			return value
+		}
+
+		p.Trigger("warn", map[string]interface{}{
+			"message": "variable reference to undefined name " + name,
+		})
+		return reference
+	})
 }
 
-// AddTagMapper adds a custom header mapper
-func (p *Parser) AddTagMapper(options map[string]interface{}) {
-	// Convert options to the parsestream.TagMapper format
-	tagMapper := parsestream.TagMapper{}
+// RenditionReport returns the rendition report for the rendition at uri, or
+// nil if the playlist does not report on it. uri is taken from Playlists or
+// MediaGroups of the multivariant playlist at multivariantURI, against which it
+// is resolved before it is matched with the resolved URI of each report. Any
+// query string, such as the _HLS_msn and _HLS_part delivery directives, is
+// ignored.
+func (m *Manifest) RenditionReport(multivariantURI, uri string) *RenditionReport {
+	target := stripQuery(ResolveURI(multivariantURI, uri))
+	for _, report := range m.RenditionReports {
+		if stripQuery(report.ResolvedURI) == target {
+			return report
+		}
+	}
+	return nil
+}
 
-	if expr, ok := options["expression"].(*regexp.Regexp); ok {
-		tagMapper.Expression = expr
+// ResolveURI resolves uri against base, returning uri unchanged if either
+// cannot be parsed
+func ResolveURI(base, uri string) string {
+	if base == "" {
+		return uri
 	}
 
-	if mapFunc, ok := options["map"].(func(string) string); ok {
-		tagMapper.Map = mapFunc
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return uri
 	}
 
-	p.ParseStream.AddTagMapper(tagMapper)
+	ref, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	return baseURL.ResolveReference(ref).String()
 }
 
-// Helper function to convert strings to camelCase
-func camelCase(str string) string {
-	str = strings.ToLower(str)
-	re := regexp.MustCompile(`-(\w)`)
-	return re.ReplaceAllStringFunc(str, func(s string) string {
-		return strings.ToUpper(string(s[1]))
-	})
+// stripQuery removes the query string and fragment from uri
+func stripQuery(uri string) string {
+	if i := strings.IndexAny(uri, "?#"); i != -1 {
+		return uri[:i]
+	}
+	return uri
 }
 
-// Helper function to convert keys in a map to camelCase
-func camelCaseKeys(attributes map[string]string) map[string]interface{} {
-	result := make(map[string]interface{})
+// isYes returns true for the enumerated string YES, which parsestream
+// already converts to "true" for some attributes
+func isYes(value string) bool {
+	return value == "YES" || value == "true"
+}
 
-	for key, value := range attributes {
-		// Convert string values to appropriate types
-		switch key {
-		case "DURATION", "TIME-OFFSET", "PART-TARGET":
-			if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
-				result[camelCase(key)] = floatVal
-			} else {
-				result[camelCase(key)] = value
-			}
-		case "PRECISE", "CAN-SKIP-DATERANGES", "CAN-BLOCK-RELOAD":
-			result[camelCase(key)] = regexp.MustCompile(`YES`).MatchString(value)
-		case "SKIPPED-SEGMENTS":
-			if intVal, err := strconv.Atoi(value); err == nil {
-				result[camelCase(key)] = intVal
-			} else {
-				result[camelCase(key)] = value
+// KeyForFormat returns the key of the segment with the given KEYFORMAT, e.g.
+// "com.apple.streamingkeydelivery" or DefaultKeyFormat, or nil if there is none
+func (s *Segment) KeyForFormat(keyFormat string) *Key {
+	return findKey(s.Keys, keyFormat)
+}
+
+// KeyForFormat returns the key of the initialization segment with the
+// given KEYFORMAT, or nil if there is none
+func (m *Map) KeyForFormat(keyFormat string) *Key {
+	return findKey(m.Keys, keyFormat)
+}
+
+// findKey returns the key with the given KEYFORMAT
+func findKey(keys []*Key, keyFormat string) *Key {
+	for _, key := range keys {
+		if key.KeyFormat == keyFormat {
+			return key
+		}
+	}
+	return nil
+}
+
+// keyFromAttributes creates a key from the attributes of #EXT-X-KEY or
+// #EXT-X-SESSION-KEY, applying the defaults for METHOD, KEYFORMAT and
+// KEYFORMATVERSIONS
+func keyFromAttributes(attrs map[string]string) *Key {
+	key := &Key{
+		Method:            MethodAES128,
+		URI:               attrs["URI"],
+		KeyFormat:         DefaultKeyFormat,
+		KeyFormatVersions: []int{1},
+	}
+
+	if method, ok := attrs["METHOD"]; ok {
+		key.Method = EncryptionMethod(method)
+	}
+
+	if iv, ok := attrs["IV"]; ok {
+		key.IV = iv
+	}
+
+	if keyFormat, ok := attrs["KEYFORMAT"]; ok {
+		key.KeyFormat = keyFormat
+	}
+
+	if keyFormatVersions, ok := attrs["KEYFORMATVERSIONS"]; ok {
+		key.KeyFormatVersions = []int{}
+		for _, version := range strings.Split(keyFormatVersions, "/") {
+			if number, err := strconv.Atoi(strings.TrimSpace(version)); err == nil {
+				key.KeyFormatVersions = append(key.KeyFormatVersions, number)
 			}
-		default:
-			result[camelCase(key)] = value
 		}
 	}
 
-	return result
+	return key
+}
+
+// Duration returns the total duration of all segments in seconds
+func (m *Manifest) Duration() float64 {
+	duration := 0.0
+	for _, segment := range m.Segments {
+		duration += segment.Duration
+	}
+	return duration
+}
+
+// GapDuration returns the duration in seconds of the segments marked with
+// #EXT-X-GAP, which must not be loaded
+func (m *Manifest) GapDuration() float64 {
+	duration := 0.0
+	for _, segment := range m.Segments {
+		if segment.Gap {
+			duration += segment.Duration
+		}
+	}
+	return duration
+}
+
+// PlayableDuration returns the duration in seconds of the segments that
+// are available, i.e. the total duration without gaps
+func (m *Manifest) PlayableDuration() float64 {
+	return m.Duration() - m.GapDuration()
 }
 
 // IsMasterPlaylist returns true if the manifest represents a master playlist
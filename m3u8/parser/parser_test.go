@@ -0,0 +1,159 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenditionReport(t *testing.T) {
+	manifest := parseString(t, `#EXTM3U
+#EXT-X-VERSION:9
+#EXT-X-TARGETDURATION:4
+#EXT-X-PART-INF:PART-TARGET=1
+#EXT-X-MEDIA-SEQUENCE:10
+#EXTINF:4,
+segment10.mp4
+#EXT-X-RENDITION-REPORT:URI="../audio/en.m3u8",LAST-MSN=10,LAST-PART=3
+#EXT-X-RENDITION-REPORT:URI="/video/720.m3u8?token=1",LAST-MSN=10
+`, WithURI("https://example.com/live/video/1080.m3u8"))
+
+	tests := []struct {
+		multivariantURI string
+		uri             string
+		want            string
+	}{
+		{"https://example.com/live/main.m3u8", "audio/en.m3u8", "../audio/en.m3u8"},
+		{"https://example.com/live/main.m3u8", "https://example.com/live/audio/en.m3u8?_HLS_msn=10", "../audio/en.m3u8"},
+		{"https://example.com/main.m3u8", "video/720.m3u8", "/video/720.m3u8?token=1"},
+		{"https://example.com/main.m3u8", "audio/en.m3u8", ""},
+		{"https://example.com/live/main.m3u8", "video/720.m3u8", ""},
+	}
+
+	for _, test := range tests {
+		report := manifest.RenditionReport(test.multivariantURI, test.uri)
+		got := ""
+		if report != nil {
+			got = report.URI
+		}
+		if got != test.want {
+			t.Errorf("%s relative to %s: got report %q, want %q", test.uri, test.multivariantURI, got, test.want)
+		}
+	}
+}
+
+func TestBitrate(t *testing.T) {
+	input := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10,
+segment0.ts
+#EXT-X-BITRATE:800
+#EXTINF:10,
+segment1.ts
+#EXTINF:10,
+segment2.ts
+#EXT-X-BITRATE:0
+#EXTINF:10,
+segment3.ts
+#EXT-X-ENDLIST
+`
+	manifest := parseString(t, input)
+
+	want := []int{0, 800, 800, 0}
+	for i, segment := range manifest.Segments {
+		if segment.Bitrate != want[i] {
+			t.Errorf("segment %d: got bitrate %d, want %d", i, segment.Bitrate, want[i])
+		}
+	}
+
+	output, err := manifest.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(output), "#EXT-X-BITRATE:0\n#EXTINF:10,\nsegment3.ts") {
+		t.Errorf("the bitrate reset was not written:\n%s", output)
+	}
+}
+
+// warnings parses a playlist and returns the messages of its warn events
+func warnings(t *testing.T, playlist string, opts ...Option) []string {
+	t.Helper()
+	messages := []string{}
+	p := New(opts...)
+	p.On("warn", func(data interface{}) {
+		if event, ok := data.(map[string]interface{}); ok {
+			message, _ := event["message"].(string)
+			messages = append(messages, message)
+		}
+	})
+	p.Push(playlist)
+	if err := p.End(); err != nil {
+		t.Fatal(err)
+	}
+	return messages
+}
+
+func TestSampleEncryptionKeyFormat(t *testing.T) {
+	tests := []struct {
+		key  string
+		want []string
+	}{
+		{`#EXT-X-KEY:METHOD=SAMPLE-AES,URI="key.bin"`, []string{"#EXT-X-KEY with METHOD=SAMPLE-AES lacks KEYFORMAT"}},
+		{`#EXT-X-KEY:METHOD=SAMPLE-AES-CTR,URI="key.bin"`, []string{"#EXT-X-KEY with METHOD=SAMPLE-AES-CTR lacks KEYFORMAT"}},
+		{`#EXT-X-KEY:METHOD=SAMPLE-AES,URI="key.bin",KEYFORMAT="identity"`, []string{}},
+		{`#EXT-X-KEY:METHOD=AES-128,URI="key.bin"`, []string{}},
+	}
+
+	for _, test := range tests {
+		got := warnings(t, "#EXTM3U\n#EXT-X-VERSION:5\n#EXT-X-TARGETDURATION:10\n"+test.key+"\n#EXTINF:10,\nsegment.ts\n")
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got warnings %q, want %q", test.key, got, test.want)
+		}
+	}
+}
+
+func TestMediaUnknownType(t *testing.T) {
+	got := warnings(t, `#EXTM3U
+#EXT-X-MEDIA:TYPE=DATA,GROUP-ID="data",NAME="Data"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000
+low.m3u8
+`)
+	want := []string{"ignoring media with unknown TYPE DATA"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got warnings %q, want %q", got, want)
+	}
+}
+
+func TestNewParserChecked(t *testing.T) {
+	// the options as decoded from JSON
+	p, err := NewParserChecked(map[string]interface{}{
+		"uri":             "https://example.com/main.m3u8",
+		"mainDefinitions": map[string]interface{}{"host": "example.com"},
+		"lossless":        true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.URI != "https://example.com/main.m3u8" || p.MainDefinitions["host"] != "example.com" || !p.Lossless {
+		t.Errorf("got URI %q, main definitions %v and lossless %v", p.URI, p.MainDefinitions, p.Lossless)
+	}
+
+	p, err = NewParserChecked(map[string]interface{}{
+		"uri":             "https://example.com/main.m3u8",
+		"mainDefinition":  map[string]string{"host": "example.com"},
+		"strict":          "true",
+		"mainDefinitions": map[string]interface{}{"port": 443},
+	})
+	want := []string{
+		`parser option "mainDefinition" is unknown`,
+		`parser option "mainDefinitions" has a value of the wrong type map[string]interface {}`,
+		`parser option "strict" has a value of the wrong type string`,
+	}
+	if err == nil || err.Error() != strings.Join(want, "\n") {
+		t.Errorf("got error %v, want %q", err, strings.Join(want, "\n"))
+	}
+	// the valid options are still applied
+	if p.URI != "https://example.com/main.m3u8" || p.Strict || len(p.MainDefinitions) != 0 {
+		t.Errorf("got URI %q, main definitions %v and strict %v", p.URI, p.MainDefinitions, p.Strict)
+	}
+}
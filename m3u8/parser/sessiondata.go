@@ -0,0 +1,69 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Fetcher loads the resource at uri
+type Fetcher func(ctx context.Context, uri string) ([]byte, error)
+
+// Load returns the session data. Inline data is returned from VALUE as is,
+// data referenced by URI is loaded through fetch, which receives the URI
+// exactly as it appears in the playlist. Data with FORMAT=JSON is checked
+// to be valid JSON.
+func (s *SessionData) Load(ctx context.Context, fetch Fetcher) ([]byte, error) {
+	if s.URI == "" {
+		return []byte(s.Value), nil
+	}
+
+	if fetch == nil {
+		return nil, fmt.Errorf("session data %s: no fetcher to load %s", s.DataID, s.URI)
+	}
+
+	data, err := fetch(ctx, s.URI)
+	if err != nil {
+		return nil, fmt.Errorf("session data %s: %w", s.DataID, err)
+	}
+
+	if s.Format != "RAW" && !json.Valid(data) {
+		return nil, fmt.Errorf("session data %s: %s does not contain valid JSON", s.DataID, s.URI)
+	}
+
+	return data, nil
+}
+
+// LoadJSON loads session data referenced by URI with FORMAT=JSON and decodes it into v
+func (s *SessionData) LoadJSON(ctx context.Context, fetch Fetcher, v interface{}) error {
+	if s.URI == "" {
+		return fmt.Errorf("session data %s: inline VALUE is not JSON", s.DataID)
+	}
+
+	if s.Format == "RAW" {
+		return fmt.Errorf("session data %s: cannot decode FORMAT=RAW as JSON", s.DataID)
+	}
+
+	data, err := s.Load(ctx, fetch)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("session data %s: %w", s.DataID, err)
+	}
+
+	return nil
+}
+
+// SessionDataByID returns the session data entries with the given DATA-ID,
+// one per LANGUAGE
+func (m *Manifest) SessionDataByID(dataID string) []*SessionData {
+	result := []*SessionData{}
+	for _, sessionData := range m.SessionData {
+		if sessionData.DataID == dataID {
+			result = append(result, sessionData)
+		}
+	}
+	return result
+}
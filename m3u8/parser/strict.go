@@ -0,0 +1,415 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseError is a malformed line found by a parser in strict mode
+type ParseError struct {
+	// Line and Column are the 1-based position of the malformed value; the
+	// column counts bytes
+	Line   int
+	Column int
+	// Text is the line as it appeared in the input, without line terminator
+	Text string
+	// Tag is the name of the malformed tag, e.g. #EXT-X-KEY
+	Tag     string
+	Message string
+}
+
+// Error formats the position, tag and message of the error
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s %s", e.Line, e.Column, e.Tag, e.Message)
+}
+
+// ParseErrors are the malformed lines of a playlist in input order, returned
+// by End in strict mode
+type ParseErrors []*ParseError
+
+// Error formats the first error and the number of further errors
+func (e ParseErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "no parse errors"
+	case 1:
+		return e[0].Error()
+	default:
+		return fmt.Sprintf("%s (and %d more errors)", e[0].Error(), len(e)-1)
+	}
+}
+
+// Unwrap returns the errors for errors.Is and errors.As
+func (e ParseErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// valueKind is the syntax of the value of a tag
+type valueKind int
+
+const (
+	valueNone valueKind = iota
+	valueInteger
+	valueDuration
+	valueByterange
+	valueEnum
+	valueDateTime
+	valueAttributes
+)
+
+// tagSyntax is the syntax of the value of a tag
+type tagSyntax struct {
+	kind valueKind
+	// values are the enumerated values of a valueEnum tag
+	values []string
+	// required are the attributes of a valueAttributes tag without which
+	// the parser ignores the tag
+	required []string
+}
+
+// tagSyntaxes are the syntaxes of the standard tags checked in strict mode.
+// Unknown and non-standard tags such as #EXT-X-CUE-OUT are not checked.
+var tagSyntaxes = map[string]tagSyntax{
+	"#EXTM3U":                       {kind: valueNone},
+	"#EXTINF":                       {kind: valueDuration},
+	"#EXT-X-VERSION":                {kind: valueInteger},
+	"#EXT-X-TARGETDURATION":         {kind: valueInteger},
+	"#EXT-X-MEDIA-SEQUENCE":         {kind: valueInteger},
+	"#EXT-X-DISCONTINUITY-SEQUENCE": {kind: valueInteger},
+	"#EXT-X-BITRATE":                {kind: valueInteger},
+	"#EXT-X-BYTERANGE":              {kind: valueByterange},
+	"#EXT-X-PLAYLIST-TYPE":          {kind: valueEnum, values: []string{"EVENT", "VOD"}},
+	"#EXT-X-ALLOW-CACHE":            {kind: valueEnum, values: []string{"YES", "NO"}},
+	"#EXT-X-PROGRAM-DATE-TIME":      {kind: valueDateTime},
+	"#EXT-X-ENDLIST":                {kind: valueNone},
+	"#EXT-X-DISCONTINUITY":          {kind: valueNone},
+	"#EXT-X-GAP":                    {kind: valueNone},
+	"#EXT-X-INDEPENDENT-SEGMENTS":   {kind: valueNone},
+	"#EXT-X-I-FRAMES-ONLY":          {kind: valueNone},
+	"#EXT-X-KEY":                    {kind: valueAttributes, required: []string{"METHOD"}},
+	"#EXT-X-SESSION-KEY":            {kind: valueAttributes, required: []string{"METHOD", "URI"}},
+	"#EXT-X-MAP":                    {kind: valueAttributes, required: []string{"URI"}},
+	"#EXT-X-MEDIA":                  {kind: valueAttributes, required: []string{"TYPE", "GROUP-ID", "NAME"}},
+	"#EXT-X-STREAM-INF":             {kind: valueAttributes, required: []string{"BANDWIDTH"}},
+	"#EXT-X-I-FRAME-STREAM-INF":     {kind: valueAttributes, required: []string{"BANDWIDTH", "URI"}},
+	"#EXT-X-SESSION-DATA":           {kind: valueAttributes, required: []string{"DATA-ID"}},
+	"#EXT-X-START":                  {kind: valueAttributes, required: []string{"TIME-OFFSET"}},
+	"#EXT-X-DATERANGE":              {kind: valueAttributes, required: []string{"ID", "START-DATE"}},
+	"#EXT-X-PART":                   {kind: valueAttributes, required: []string{"URI", "DURATION"}},
+	"#EXT-X-PART-INF":               {kind: valueAttributes, required: []string{"PART-TARGET"}},
+	"#EXT-X-SERVER-CONTROL":         {kind: valueAttributes},
+	"#EXT-X-SKIP":                   {kind: valueAttributes, required: []string{"SKIPPED-SEGMENTS"}},
+	"#EXT-X-PRELOAD-HINT":           {kind: valueAttributes, required: []string{"TYPE", "URI"}},
+	"#EXT-X-RENDITION-REPORT":       {kind: valueAttributes, required: []string{"URI"}},
+	"#EXT-X-CONTENT-STEERING":       {kind: valueAttributes, required: []string{"SERVER-URI"}},
+	"#EXT-X-DEFINE":                 {kind: valueAttributes},
+}
+
+// attributeKind is the type of an attribute value
+type attributeKind int
+
+const (
+	attributeInteger attributeKind = iota + 1
+	attributeFloat
+	attributeSignedFloat
+	attributeResolution
+	attributeHex
+	attributeYesNo
+)
+
+// attributeKinds are the types of the attributes that are neither quoted
+// strings nor enumerated strings
+var attributeKinds = map[string]attributeKind{
+	"BANDWIDTH":           attributeInteger,
+	"AVERAGE-BANDWIDTH":   attributeInteger,
+	"PROGRAM-ID":          attributeInteger,
+	"LAST-MSN":            attributeInteger,
+	"LAST-PART":           attributeInteger,
+	"SKIPPED-SEGMENTS":    attributeInteger,
+	"BYTERANGE-START":     attributeInteger,
+	"BYTERANGE-LENGTH":    attributeInteger,
+	"DURATION":            attributeFloat,
+	"PLANNED-DURATION":    attributeFloat,
+	"FRAME-RATE":          attributeFloat,
+	"PART-TARGET":         attributeFloat,
+	"HOLD-BACK":           attributeFloat,
+	"PART-HOLD-BACK":      attributeFloat,
+	"CAN-SKIP-UNTIL":      attributeFloat,
+	"SCORE":               attributeFloat,
+	"TIME-OFFSET":         attributeSignedFloat,
+	"RESOLUTION":          attributeResolution,
+	"IV":                  attributeHex,
+	"DEFAULT":             attributeYesNo,
+	"AUTOSELECT":          attributeYesNo,
+	"FORCED":              attributeYesNo,
+	"PRECISE":             attributeYesNo,
+	"INDEPENDENT":         attributeYesNo,
+	"GAP":                 attributeYesNo,
+	"CAN-BLOCK-RELOAD":    attributeYesNo,
+	"CAN-SKIP-DATERANGES": attributeYesNo,
+	"END-ON-NEXT":         attributeYesNo,
+}
+
+var (
+	integerPattern        = regexp.MustCompile(`^[0-9]+$`)
+	floatPattern          = regexp.MustCompile(`^[0-9]+(\.[0-9]*)?$`)
+	signedFloatPattern    = regexp.MustCompile(`^-?[0-9]+(\.[0-9]*)?$`)
+	resolutionPattern     = regexp.MustCompile(`^[0-9]+x[0-9]+$`)
+	hexPattern            = regexp.MustCompile(`^0[xX][0-9a-fA-F]+$`)
+	byterangePattern      = regexp.MustCompile(`^[0-9]+(@[0-9]+)?$`)
+	attributeNamePattern  = regexp.MustCompile(`^[A-Z0-9-]+$`)
+	enumPattern           = regexp.MustCompile(`^[^\s",]+$`)
+	keyFormatVersionsList = regexp.MustCompile(`^[0-9]+(/[0-9]+)*$`)
+)
+
+// strictChecker checks the syntax of every line read by a parser in strict
+// mode
+type strictChecker struct {
+	line   int
+	errors ParseErrors
+}
+
+// lineCheck reports the errors of a single line
+type lineCheck struct {
+	checker *strictChecker
+	text    string
+	tag     string
+}
+
+// fail reports an error at a 0-based byte offset of the line
+func (l *lineCheck) fail(offset int, format string, args ...interface{}) {
+	l.checker.errors = append(l.checker.errors, &ParseError{
+		Line:    l.checker.line,
+		Column:  offset + 1,
+		Text:    l.text,
+		Tag:     l.tag,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// check checks the next line of the input
+func (c *strictChecker) check(text string) {
+	c.line++
+	text = strings.TrimSuffix(text, "\r")
+
+	trimmed := strings.TrimSpace(text)
+	if !strings.HasPrefix(trimmed, "#EXT") {
+		return
+	}
+	start := strings.Index(text, trimmed)
+
+	name, value, hasValue := strings.Cut(trimmed, ":")
+	syntax, ok := tagSyntaxes[name]
+	if !ok {
+		return
+	}
+
+	l := &lineCheck{checker: c, text: text, tag: name}
+	offset := start + len(name) + 1
+
+	switch syntax.kind {
+	case valueNone:
+		if hasValue {
+			l.fail(offset-1, "must not have a value")
+		}
+		return
+	}
+
+	if !hasValue {
+		l.fail(start+len(name), "lacks a value")
+		return
+	}
+
+	switch syntax.kind {
+	case valueInteger:
+		if !isInteger(value) {
+			l.fail(offset, "has invalid decimal integer %q", value)
+		}
+
+	case valueDuration:
+		// the comma before the title is often omitted, which the parser accepts
+		duration, _, _ := strings.Cut(value, ",")
+		if !floatPattern.MatchString(duration) {
+			l.fail(offset, "has invalid duration %q", duration)
+		}
+
+	case valueByterange:
+		if !isByterange(value) {
+			l.fail(offset, "has invalid byte range %q", value)
+		}
+
+	case valueEnum:
+		if !contains(syntax.values, value) {
+			l.fail(offset, "has invalid value %q, expected one of %s", value, strings.Join(syntax.values, ", "))
+		}
+
+	case valueDateTime:
+		if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+			l.fail(offset, "has invalid date and time %q", value)
+		}
+
+	case valueAttributes:
+		attrs, ok := l.scanAttributes(value, offset)
+		if !ok {
+			return
+		}
+		for _, name := range syntax.required {
+			if _, ok := attrs[name]; !ok {
+				l.fail(offset, "lacks required attribute %s", name)
+			}
+		}
+	}
+}
+
+// scanAttributes checks the syntax of an attribute list starting at offset
+// and the values of its attributes. It returns the names of the attributes,
+// or false if the list cannot be read.
+func (l *lineCheck) scanAttributes(list string, offset int) (map[string]bool, bool) {
+	names := make(map[string]bool)
+	pos := 0
+	for pos < len(list) {
+		equals := strings.IndexByte(list[pos:], '=')
+		if equals < 0 {
+			l.fail(offset+pos, "has an attribute without value")
+			return names, false
+		}
+		name := list[pos : pos+equals]
+		if !attributeNamePattern.MatchString(name) {
+			l.fail(offset+pos, "has invalid attribute name %q", name)
+			return names, false
+		}
+		if names[name] {
+			l.fail(offset+pos, "has attribute %s more than once", name)
+		}
+		names[name] = true
+		pos += equals + 1
+
+		valueOffset := offset + pos
+		var value string
+		quoted := pos < len(list) && list[pos] == '"'
+		if quoted {
+			end := strings.IndexByte(list[pos+1:], '"')
+			if end < 0 {
+				l.fail(valueOffset, "has unterminated quoted string in attribute %s", name)
+				return names, false
+			}
+			value = list[pos+1 : pos+1+end]
+			pos += end + 2
+		} else {
+			end := strings.IndexByte(list[pos:], ',')
+			if end < 0 {
+				end = len(list) - pos
+			}
+			value = list[pos : pos+end]
+			pos += end
+		}
+
+		l.checkAttribute(name, value, quoted, valueOffset)
+
+		if pos < len(list) {
+			if list[pos] != ',' {
+				l.fail(offset+pos, "lacks a comma after attribute %s", name)
+				return names, false
+			}
+			pos++
+			if pos == len(list) {
+				l.fail(offset+pos-1, "has a trailing comma")
+			}
+		}
+	}
+	return names, true
+}
+
+// checkAttribute checks the value of an attribute against its type
+func (l *lineCheck) checkAttribute(name, value string, quoted bool, offset int) {
+	switch {
+	case quotedAttributes[name]:
+		if !quoted && !(name == "CLOSED-CAPTIONS" && value == "NONE") {
+			l.fail(offset, "attribute %s must be a quoted string", name)
+			return
+		}
+		if strings.Contains(value, "{$") {
+			// variable references are substituted before the value is used
+			return
+		}
+		switch name {
+		case "BYTERANGE":
+			if !isByterange(value) {
+				l.fail(offset, "has invalid byte range %q in attribute %s", value, name)
+			}
+		case "START-DATE", "END-DATE":
+			if _, err := time.Parse(time.RFC3339Nano, value); err != nil {
+				l.fail(offset, "has invalid date %q in attribute %s", value, name)
+			}
+		case "KEYFORMATVERSIONS":
+			if !keyFormatVersionsList.MatchString(value) {
+				l.fail(offset, "has invalid versions %q in attribute %s", value, name)
+			}
+		}
+		return
+
+	case quoted:
+		if attributeKinds[name] != 0 || !strings.HasPrefix(name, "X-") {
+			l.fail(offset, "attribute %s must not be quoted", name)
+		}
+		return
+	}
+
+	valid := true
+	switch attributeKinds[name] {
+	case attributeInteger:
+		valid = isInteger(value)
+	case attributeFloat:
+		valid = floatPattern.MatchString(value)
+	case attributeSignedFloat:
+		valid = signedFloatPattern.MatchString(value)
+	case attributeResolution:
+		valid = resolutionPattern.MatchString(value)
+	case attributeHex:
+		valid = hexPattern.MatchString(value)
+	case attributeYesNo:
+		valid = value == "YES" || value == "NO"
+	default:
+		// enumerated strings and client attributes
+		valid = enumPattern.MatchString(value)
+	}
+	if !valid {
+		l.fail(offset, "has invalid value %q for attribute %s", value, name)
+	}
+}
+
+// isInteger reports whether a value is a decimal integer that fits in an
+// int, as the parser stores it
+func isInteger(value string) bool {
+	if !integerPattern.MatchString(value) {
+		return false
+	}
+	_, err := strconv.ParseInt(value, 10, 0)
+	return err == nil
+}
+
+// isByterange reports whether a value is a byte range of the form n[@o]
+func isByterange(value string) bool {
+	if !byterangePattern.MatchString(value) {
+		return false
+	}
+	length, offset, _ := strings.Cut(value, "@")
+	return isInteger(length) && (offset == "" || isInteger(offset))
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// strictErrors parses a playlist in strict mode and returns the parse errors
+func strictErrors(t *testing.T, playlist string) ParseErrors {
+	t.Helper()
+	p := New(WithStrict())
+	p.Push(playlist)
+	err := p.End()
+	if err == nil {
+		return nil
+	}
+	var parseErrors ParseErrors
+	if !errors.As(err, &parseErrors) {
+		t.Fatalf("got error %v, want ParseErrors", err)
+	}
+	return parseErrors
+}
+
+func TestStrict(t *testing.T) {
+	tests := []struct {
+		// line is the malformed line and value the part of it the error
+		// points at
+		line  string
+		value string
+		// message is a part of the expected message
+		message string
+	}{
+		// tag values
+		{"#EXT-X-TARGETDURATION:abc", "abc", "invalid decimal integer"},
+		{"#EXT-X-MEDIA-SEQUENCE:9223372036854775808", "9223372036854775808", "invalid decimal integer"},
+		{"#EXTINF:ten,", "ten,", "invalid duration"},
+		{"#EXT-X-BYTERANGE:100@x", "100@x", "invalid byte range"},
+		{"#EXT-X-BYTERANGE:100@99999999999999999999", "100@", "invalid byte range"},
+		{"#EXT-X-PLAYLIST-TYPE:LIVE", "LIVE", "expected one of EVENT, VOD"},
+		{"#EXT-X-PROGRAM-DATE-TIME:yesterday", "yesterday", "invalid date and time"},
+		{"#EXT-X-ENDLIST:YES", ":YES", "must not have a value"},
+		// the error points at the end of the line, where the value is missing
+		{"#EXT-X-VERSION", "", "lacks a value"},
+
+		// attribute lists
+		{`#EXT-X-KEY:METHOD=AES-128,URI`, "URI", "attribute without value"},
+		{`#EXT-X-KEY:METHOD=AES-128,uri="key.bin"`, "uri", "invalid attribute name"},
+		{`#EXT-X-KEY:METHOD=AES-128,URI="key.bin`, `"key.bin`, "unterminated quoted string"},
+		{`#EXT-X-KEY:METHOD=AES-128,URI="key.bin"IV=0x1`, `IV`, "lacks a comma"},
+		{`#EXT-X-KEY:METHOD=AES-128,URI="key.bin",`, `,`, "trailing comma"},
+		{`#EXT-X-KEY:METHOD=AES-128,METHOD=NONE`, `METHOD=NONE`, "more than once"},
+		{`#EXT-X-KEY:URI="key.bin"`, `URI`, "lacks required attribute METHOD"},
+
+		// attribute values
+		{`#EXT-X-STREAM-INF:BANDWIDTH=12x`, "12x", "BANDWIDTH"},
+		{`#EXT-X-STREAM-INF:BANDWIDTH=1,FRAME-RATE=-30`, "-30", "FRAME-RATE"},
+		{`#EXT-X-START:TIME-OFFSET=+5`, "+5", "TIME-OFFSET"},
+		{`#EXT-X-STREAM-INF:BANDWIDTH=1,RESOLUTION=640*360`, "640*360", "RESOLUTION"},
+		{`#EXT-X-KEY:METHOD=AES-128,URI="key.bin",IV=1234`, "1234", "IV"},
+		{`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="en",DEFAULT=yes`, "yes", "DEFAULT"},
+		{`#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=aac,NAME="en"`, "aac", "must be a quoted string"},
+		{`#EXT-X-STREAM-INF:BANDWIDTH="1"`, `"1"`, "must not be quoted"},
+		{`#EXT-X-MAP:URI="init.mp4",BYTERANGE="100@x"`, `"100@x"`, "invalid byte range"},
+		{`#EXT-X-DATERANGE:ID="ad",START-DATE="yesterday"`, `"yesterday"`, "invalid date"},
+		{`#EXT-X-KEY:METHOD=SAMPLE-AES,URI="key.bin",KEYFORMATVERSIONS="1,2"`, `"1,2"`, "invalid versions"},
+	}
+
+	for _, test := range tests {
+		playlist := "#EXTM3U\n" + test.line + "\n"
+		parseErrors := strictErrors(t, playlist)
+		if len(parseErrors) != 1 {
+			t.Errorf("%s: got errors %v, want 1", test.line, parseErrors)
+			continue
+		}
+
+		got := parseErrors[0]
+		tag, _, _ := strings.Cut(test.line, ":")
+		column := strings.LastIndex(test.line, test.value) + 1
+		if got.Line != 2 || got.Column != column || got.Text != test.line || got.Tag != tag {
+			t.Errorf("%s: got line %d, column %d, text %q and tag %s, want line 2, column %d, text %q and tag %s",
+				test.line, got.Line, got.Column, got.Text, got.Tag, column, test.line, tag)
+		}
+		if !strings.Contains(got.Message, test.message) {
+			t.Errorf("%s: got message %q, want it to contain %q", test.line, got.Message, test.message)
+		}
+	}
+}
+
+func TestStrictValid(t *testing.T) {
+	for _, name := range fixtures {
+		if parseErrors := strictErrors(t, readFixture(t, name)); parseErrors != nil {
+			t.Errorf("%s: %v", name, parseErrors)
+		}
+	}
+
+	// the largest value that fits in an int
+	if parseErrors := strictErrors(t, "#EXTM3U\n#EXT-X-MEDIA-SEQUENCE:9223372036854775807\n"); parseErrors != nil {
+		t.Errorf("got errors %v", parseErrors)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	p := New(WithStrict())
+	p.Push("#EXTM3U\r\n#EXT-X-TARGETDURATION:abc\r\n#EXTINF:10,\r\nsegment.ts\r\n  #EXT-X-BITRATE:x\r\n")
+	err := p.End()
+
+	var parseErrors ParseErrors
+	if !errors.As(err, &parseErrors) || len(parseErrors) != 2 {
+		t.Fatalf("got error %v, want two ParseErrors", err)
+	}
+
+	// errors.As finds the first error through ParseErrors.Unwrap
+	var parseError *ParseError
+	if !errors.As(err, &parseError) {
+		t.Fatalf("errors.As did not find a *ParseError in %v", err)
+	}
+	want := ParseError{
+		Line:    2,
+		Column:  23,
+		Text:    "#EXT-X-TARGETDURATION:abc",
+		Tag:     "#EXT-X-TARGETDURATION",
+		Message: `has invalid decimal integer "abc"`,
+	}
+	if *parseError != want {
+		t.Errorf("got %+v, want %+v", *parseError, want)
+	}
+
+	// the column of an indented tag counts the leading blanks
+	if second := parseErrors[1]; second.Line != 5 || second.Column != 18 || second.Text != "  #EXT-X-BITRATE:x" {
+		t.Errorf("got %+v", *second)
+	}
+
+	if got, want := err.Error(), `line 2, column 23: #EXT-X-TARGETDURATION has invalid decimal integer "abc" (and 1 more errors)`; got != want {
+		t.Errorf("got message %q, want %q", got, want)
+	}
+}
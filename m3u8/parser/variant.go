@@ -0,0 +1,190 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parsestream"
+)
+
+// Variant represents a variant stream declared by #EXT-X-STREAM-INF. The
+// typed fields are parsed from Attributes; fields whose attribute is absent
+// or malformed are zero.
+type Variant struct {
+	URI              string
+	Bandwidth        int
+	AverageBandwidth int
+	// Codecs are the entries of CODECS, e.g. avc1.64001f and mp4a.40.2
+	Codecs []string
+	// Resolution is nil when the variant does not declare one
+	Resolution *parsestream.Resolution
+	FrameRate  float64
+	HDCPLevel  string
+	VideoRange string
+	// Audio, Video, Subtitles and ClosedCaptions are the GROUP-IDs of the
+	// renditions the variant uses. ClosedCaptions is NONE if the variant
+	// has no closed captions.
+	Audio           string
+	Video           string
+	Subtitles       string
+	ClosedCaptions  string
+	Score           float64
+	PathwayID       string
+	StableVariantID string
+	// Attributes are the attributes as written in the playlist. Marshal
+	// writes the typed fields in place of the attributes they are parsed
+	// from, and the other attributes as they are.
+	Attributes map[string]string
+	// Lines are the input lines of the variant stream in lossless mode
+	Lines []*Line
+
+	// canonical is the variant stream as it was written when parsed in
+	// lossless mode
+	canonical string
+	// position orders the segments and variant streams read in lossless mode
+	position int
+}
+
+// NewVariant returns a variant stream with its typed fields parsed from the
+// attributes of #EXT-X-STREAM-INF or #EXT-X-I-FRAME-STREAM-INF. The
+// attributes are copied.
+func NewVariant(uri string, attributes map[string]string) *Variant {
+	variant := &Variant{
+		URI:        uri,
+		Attributes: make(map[string]string, len(attributes)),
+	}
+	for name, value := range attributes {
+		variant.Attributes[name] = value
+	}
+
+	variant.Bandwidth = parseInt(attributes["BANDWIDTH"])
+	variant.AverageBandwidth = parseInt(attributes["AVERAGE-BANDWIDTH"])
+	variant.Codecs = parseCodecs(attributes["CODECS"])
+	if resolution, ok := attributes["RESOLUTION"]; ok {
+		variant.Resolution = parseResolution(resolution)
+	}
+	variant.FrameRate = parseFloat(attributes["FRAME-RATE"])
+	variant.HDCPLevel = attributes["HDCP-LEVEL"]
+	variant.VideoRange = attributes["VIDEO-RANGE"]
+	variant.Audio = attributes["AUDIO"]
+	variant.Video = attributes["VIDEO"]
+	variant.Subtitles = attributes["SUBTITLES"]
+	variant.ClosedCaptions = attributes["CLOSED-CAPTIONS"]
+	variant.Score = parseFloat(attributes["SCORE"])
+	variant.PathwayID = attributes["PATHWAY-ID"]
+	variant.StableVariantID = attributes["STABLE-VARIANT-ID"]
+	return variant
+}
+
+// typedAttribute is an attribute of a variant stream that has a typed field
+type typedAttribute struct {
+	name string
+	// value is the field formatted as an attribute value
+	value string
+	zero  bool
+	// normalize formats an attribute value as parsing it into the field and
+	// formatting the field would
+	normalize func(string) string
+}
+
+// attributeValues returns the attributes of the variant as they are written:
+// the typed fields, and the other attributes as they were read. A typed field
+// is written as it was read if it still has the value parsed from it, and left
+// out if it is zero and was not read.
+func (v *Variant) attributeValues() map[string]string {
+	values := make(map[string]string, len(v.Attributes))
+	for name, value := range v.Attributes {
+		if name != "URI" {
+			values[name] = value
+		}
+	}
+
+	resolution := ""
+	if v.Resolution != nil {
+		resolution = formatResolution(v.Resolution)
+	}
+	same := func(value string) string { return value }
+	typed := []typedAttribute{
+		{"BANDWIDTH", strconv.Itoa(v.Bandwidth), v.Bandwidth == 0, normalizeInt},
+		{"AVERAGE-BANDWIDTH", strconv.Itoa(v.AverageBandwidth), v.AverageBandwidth == 0, normalizeInt},
+		{"CODECS", strings.Join(v.Codecs, ","), len(v.Codecs) == 0, normalizeCodecs},
+		{"RESOLUTION", resolution, v.Resolution == nil, normalizeResolution},
+		{"FRAME-RATE", formatFloat(v.FrameRate), v.FrameRate == 0, normalizeFloat},
+		{"HDCP-LEVEL", v.HDCPLevel, v.HDCPLevel == "", same},
+		{"VIDEO-RANGE", v.VideoRange, v.VideoRange == "", same},
+		{"AUDIO", v.Audio, v.Audio == "", same},
+		{"VIDEO", v.Video, v.Video == "", same},
+		{"SUBTITLES", v.Subtitles, v.Subtitles == "", same},
+		{"CLOSED-CAPTIONS", v.ClosedCaptions, v.ClosedCaptions == "", same},
+		{"SCORE", formatFloat(v.Score), v.Score == 0, normalizeFloat},
+		{"PATHWAY-ID", v.PathwayID, v.PathwayID == "", same},
+		{"STABLE-VARIANT-ID", v.StableVariantID, v.StableVariantID == "", same},
+	}
+	for _, attribute := range typed {
+		raw, ok := values[attribute.name]
+		switch {
+		case ok && attribute.normalize(raw) == attribute.value:
+			// keep the value as it was read
+		case attribute.zero:
+			delete(values, attribute.name)
+		default:
+			values[attribute.name] = attribute.value
+		}
+	}
+	return values
+}
+
+// parseInt parses a decimal integer, returning 0 if it is malformed
+func parseInt(value string) int {
+	number, _ := strconv.Atoi(value)
+	return number
+}
+
+// parseFloat parses a decimal floating-point number, returning 0 if it is
+// malformed
+func parseFloat(value string) float64 {
+	number, _ := strconv.ParseFloat(value, 64)
+	return number
+}
+
+// parseCodecs splits a CODECS attribute into its entries
+func parseCodecs(value string) []string {
+	var codecs []string
+	for _, codec := range strings.Split(value, ",") {
+		if codec = strings.TrimSpace(codec); codec != "" {
+			codecs = append(codecs, codec)
+		}
+	}
+	return codecs
+}
+
+// parseResolution parses a RESOLUTION attribute of the form WIDTHxHEIGHT
+func parseResolution(value string) *parsestream.Resolution {
+	width, height, _ := strings.Cut(value, "x")
+	return &parsestream.Resolution{Width: parseInt(width), Height: parseInt(height)}
+}
+
+// formatResolution formats a resolution as a RESOLUTION attribute
+func formatResolution(resolution *parsestream.Resolution) string {
+	return strconv.Itoa(resolution.Width) + "x" + strconv.Itoa(resolution.Height)
+}
+
+// normalizeInt normalizes a decimal integer attribute
+func normalizeInt(value string) string {
+	return strconv.Itoa(parseInt(value))
+}
+
+// normalizeFloat normalizes a decimal floating-point attribute
+func normalizeFloat(value string) string {
+	return formatFloat(parseFloat(value))
+}
+
+// normalizeCodecs normalizes a CODECS attribute
+func normalizeCodecs(value string) string {
+	return strings.Join(parseCodecs(value), ",")
+}
+
+// normalizeResolution normalizes a RESOLUTION attribute
+func normalizeResolution(value string) string {
+	return formatResolution(parseResolution(value))
+}
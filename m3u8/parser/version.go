@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// VersionRequirement is a feature used by a playlist together with the
+// lowest protocol version that supports it
+type VersionRequirement struct {
+	Version int
+	// Feature describes the feature, e.g. "#EXT-X-BYTERANGE"
+	Feature string
+}
+
+// MinimumVersion returns the lowest protocol version that supports every
+// feature used by the manifest. Playlists without #EXT-X-VERSION have
+// version 1.
+func (m *Manifest) MinimumVersion() int {
+	version := 1
+	for _, requirement := range m.VersionRequirements() {
+		if requirement.Version > version {
+			version = requirement.Version
+		}
+	}
+	return version
+}
+
+// VersionRequirements returns the features used by the manifest that need a
+// protocol version above 1, ordered by decreasing version. Each feature is
+// listed once.
+func (m *Manifest) VersionRequirements() []VersionRequirement {
+	requirements := []VersionRequirement{}
+	seen := make(map[string]bool)
+	require := func(version int, feature string) {
+		if !seen[feature] {
+			seen[feature] = true
+			requirements = append(requirements, VersionRequirement{Version: version, Feature: feature})
+		}
+	}
+
+	requireKey := func(tag string, key *Key) {
+		if key == nil {
+			return
+		}
+		if key.IV != "" {
+			require(2, tag+" with IV")
+		}
+		if key.KeyFormat != "" && key.KeyFormat != DefaultKeyFormat {
+			require(5, tag+" with KEYFORMAT")
+		}
+		if len(key.KeyFormatVersions) > 1 || (len(key.KeyFormatVersions) == 1 && key.KeyFormatVersions[0] != 1) {
+			require(5, tag+" with KEYFORMATVERSIONS")
+		}
+		if key.Method.IsSampleEncryption() {
+			require(5, tag+" with METHOD="+string(key.Method))
+		}
+	}
+
+	if m.IFramesOnly {
+		require(4, "#EXT-X-I-FRAMES-ONLY")
+	}
+
+	for _, segment := range m.Segments {
+		if segment.Duration != math.Trunc(segment.Duration) && !segment.hasZeroDuration() {
+			require(3, "floating-point #EXTINF durations")
+		}
+		if segment.Byterange != nil {
+			require(4, "#EXT-X-BYTERANGE")
+		}
+		for _, key := range segment.Keys {
+			requireKey("#EXT-X-KEY", key)
+		}
+		if segment.Map != nil {
+			if m.IFramesOnly {
+				require(5, "#EXT-X-MAP")
+			} else {
+				require(6, "#EXT-X-MAP without #EXT-X-I-FRAMES-ONLY")
+			}
+		}
+	}
+
+	for _, key := range m.SessionKeys {
+		requireKey("#EXT-X-SESSION-KEY", key)
+	}
+
+	for _, groups := range m.MediaGroups {
+		for _, group := range groups {
+			for _, rendition := range group {
+				if strings.HasPrefix(rendition.InstreamID, "SERVICE") {
+					require(7, "INSTREAM-ID with a SERVICE value")
+				}
+			}
+		}
+	}
+
+	if len(m.Definitions) > 0 {
+		require(8, "variable substitution with #EXT-X-DEFINE")
+	}
+
+	if m.Skip != nil {
+		require(9, "#EXT-X-SKIP")
+		if len(m.Skip.RecentlyRemovedDateRanges) > 0 {
+			require(10, "#EXT-X-SKIP replacing #EXT-X-DATERANGE tags")
+		}
+	}
+
+	for _, playlist := range m.Playlists {
+		requireVariant(playlist.Attributes, require)
+	}
+	for _, playlist := range m.IFramePlaylists {
+		requireVariant(playlist.Attributes, require)
+	}
+
+	sort.SliceStable(requirements, func(i, j int) bool {
+		return requirements[i].Version > requirements[j].Version
+	})
+	return requirements
+}
+
+// requireVariant records the attributes of a variant stream that need a
+// protocol version above 1
+func requireVariant(attributes map[string]string, require func(int, string)) {
+	for _, name := range sortedKeys(attributes) {
+		if strings.HasPrefix(name, "REQ-") {
+			require(12, name+" attribute")
+		}
+	}
+}
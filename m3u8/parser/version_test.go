@@ -0,0 +1,32 @@
+package parser
+
+import "testing"
+
+func TestMinimumVersion(t *testing.T) {
+	tests := []struct {
+		name     string
+		playlist string
+		want     int
+	}{
+		{"integer durations", "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:10,\na.ts\n", 1},
+		{"zero duration", "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:0,\na.ts\n", 1},
+		{"floating-point duration", "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:0.01,\na.ts\n", 3},
+		{"IV", "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",IV=0x1\n#EXTINF:10,\na.ts\n", 2},
+		{"byte range", "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-BYTERANGE:100@0\n#EXTINF:10,\na.ts\n", 4},
+		{"initialization segment", "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:10,\na.mp4\n", 6},
+	}
+
+	for _, test := range tests {
+		manifest := parseString(t, test.playlist)
+		if got := manifest.MinimumVersion(); got != test.want {
+			t.Errorf("%s: got version %d, want %d", test.name, got, test.want)
+		}
+	}
+
+	// a zero duration that has been modified is versioned as written
+	manifest := parseString(t, "#EXTM3U\n#EXT-X-TARGETDURATION:10\n#EXTINF:0,\na.ts\n")
+	manifest.Segments[0].Duration = 2.5
+	if got := manifest.MinimumVersion(); got != 3 {
+		t.Errorf("modified zero duration: got version %d, want 3", got)
+	}
+}
@@ -0,0 +1,876 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parsestream"
+)
+
+// dateTimeLayout is the ISO 8601 format used for #EXT-X-PROGRAM-DATE-TIME
+// and the dates of #EXT-X-DATERANGE
+const dateTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+
+// quotedAttributes lists the attributes whose values are quoted strings.
+// All other attributes are written as they are, e.g. as decimal integers,
+// hexadecimal sequences or enumerated strings.
+var quotedAttributes = map[string]bool{
+	"URI":                         true,
+	"CODECS":                      true,
+	"SUPPLEMENTAL-CODECS":         true,
+	"AUDIO":                       true,
+	"VIDEO":                       true,
+	"SUBTITLES":                   true,
+	"CLOSED-CAPTIONS":             true,
+	"NAME":                        true,
+	"GROUP-ID":                    true,
+	"LANGUAGE":                    true,
+	"ASSOC-LANGUAGE":              true,
+	"STABLE-RENDITION-ID":         true,
+	"STABLE-VARIANT-ID":           true,
+	"CHARACTERISTICS":             true,
+	"CHANNELS":                    true,
+	"INSTREAM-ID":                 true,
+	"KEYFORMAT":                   true,
+	"KEYFORMATVERSIONS":           true,
+	"DATA-ID":                     true,
+	"VALUE":                       true,
+	"ID":                          true,
+	"CLASS":                       true,
+	"START-DATE":                  true,
+	"END-DATE":                    true,
+	"RECENTLY-REMOVED-DATERANGES": true,
+	"SERVER-URI":                  true,
+	"PATHWAY-ID":                  true,
+	"IMPORT":                      true,
+	"QUERYPARAM":                  true,
+	"BYTERANGE":                   true,
+	"ALLOWED-CPC":                 true,
+	"REQ-VIDEO-LAYOUT":            true,
+}
+
+// variantAttributeOrder is the order in which the attributes of
+// #EXT-X-STREAM-INF and #EXT-X-I-FRAME-STREAM-INF are written. Other
+// attributes follow in alphabetical order.
+var variantAttributeOrder = []string{
+	"BANDWIDTH", "AVERAGE-BANDWIDTH", "SCORE", "CODECS", "SUPPLEMENTAL-CODECS",
+	"RESOLUTION", "FRAME-RATE", "HDCP-LEVEL", "ALLOWED-CPC", "VIDEO-RANGE",
+	"REQ-VIDEO-LAYOUT", "STABLE-VARIANT-ID", "AUDIO", "VIDEO", "SUBTITLES",
+	"CLOSED-CAPTIONS", "PATHWAY-ID", "PROGRAM-ID",
+}
+
+// mediaTypeOrder is the order in which the media groups are written
+var mediaTypeOrder = []string{"AUDIO", "VIDEO", "SUBTITLES", "CLOSED-CAPTIONS"}
+
+// Marshal serializes the manifest to M3U8 text
+func (m *Manifest) Marshal() ([]byte, error) {
+	w := &playlistWriter{}
+	w.writeManifest(m)
+	if w.err != nil {
+		return nil, w.err
+	}
+	return w.buf.Bytes(), nil
+}
+
+// WriteTo writes the manifest as M3U8 text to out. Nothing is written if the
+// manifest cannot be serialized.
+func (m *Manifest) WriteTo(out io.Writer) (int64, error) {
+	data, err := m.Marshal()
+	if err != nil {
+		return 0, err
+	}
+	n, err := out.Write(data)
+	return int64(n), err
+}
+
+// playlistWriter collects the lines of a playlist and the first error
+type playlistWriter struct {
+	buf bytes.Buffer
+	err error
+	// crlf terminates lines with a carriage return and line feed
+	crlf bool
+	// entries holds the current lines of the entries of the collections and
+	// writtenEntries those already written, when writing in lossless mode
+	entries        map[entryKey]string
+	writtenEntries map[entryKey]bool
+}
+
+// line writes a single line
+func (w *playlistWriter) line(line string) {
+	if w.crlf && !strings.HasSuffix(line, "\r") {
+		line += "\r"
+	}
+	w.raw(line)
+}
+
+// raw writes a line exactly as given
+func (w *playlistWriter) raw(line string) {
+	w.buf.WriteString(line)
+	w.buf.WriteByte('\n')
+}
+
+// tag writes a tag with an attribute list
+func (w *playlistWriter) tag(name string, attrs *attributeList) {
+	w.line(w.format(name, attrs))
+}
+
+// format returns the line of a tag with an attribute list
+func (w *playlistWriter) format(name string, attrs *attributeList) string {
+	if attrs.err != nil && w.err == nil {
+		w.err = fmt.Errorf("%s: %w", name, attrs.err)
+	}
+	return name + ":" + strings.Join(attrs.attrs, ",")
+}
+
+// fail records an error unless one has already occurred
+func (w *playlistWriter) fail(format string, args ...interface{}) {
+	if w.err == nil {
+		w.err = fmt.Errorf(format, args...)
+	}
+}
+
+// headerTagTypes are the tags that occur at most once per playlist and
+// describe the playlist as a whole
+var headerTagTypes = []string{
+	"version", "independent-segments", "start", "targetduration", "media-sequence",
+	"discontinuity-sequence", "playlist-type", "i-frames-only", "allow-cache",
+	"server-control", "part-inf", "skip", "content-steering", "endlist",
+}
+
+// writeManifest writes a media or multivariant playlist
+func (w *playlistWriter) writeManifest(m *Manifest) {
+	if m.Lines != nil {
+		w.writeLossless(m)
+		return
+	}
+
+	w.line("#EXTM3U")
+	w.writeTag(m, "version")
+	w.writeTag(m, "independent-segments")
+	w.writeTag(m, "start")
+
+	for _, name := range sortedKeys(m.Definitions) {
+		attrs := &attributeList{}
+		attrs.quoted("NAME", name)
+		attrs.quoted("VALUE", m.Definitions[name])
+		w.tag("#EXT-X-DEFINE", attrs)
+	}
+
+	// custom tags can only be written if their data is the original line
+	for _, customType := range sortedKeys(m.Custom) {
+		if data, ok := m.Custom[customType].(string); ok && strings.HasPrefix(data, "#") {
+			w.line(data)
+		}
+	}
+
+	if m.isMultivariant() {
+		if len(m.Segments) > 0 {
+			w.fail("manifest contains both variant streams and media segments")
+			return
+		}
+		w.writeMultivariant(m)
+		return
+	}
+
+	w.writeMedia(m)
+}
+
+// isMultivariant returns true if the manifest contains any tag that may
+// only appear in a multivariant playlist
+func (m *Manifest) isMultivariant() bool {
+	if len(m.Playlists) > 0 || len(m.IFramePlaylists) > 0 || len(m.SessionData) > 0 ||
+		len(m.SessionKeys) > 0 || m.ContentSteering != nil {
+		return true
+	}
+	for _, groups := range m.MediaGroups {
+		if len(groups) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// writeTag writes a tag that occurs at most once per playlist, if present
+func (w *playlistWriter) writeTag(m *Manifest, tagType string) {
+	if line := w.renderTag(m, tagType); line != "" {
+		w.line(line)
+	}
+}
+
+// renderTag returns the line of a tag that occurs at most once per playlist,
+// or an empty string if the manifest does not contain it
+func (w *playlistWriter) renderTag(m *Manifest, tagType string) string {
+	multivariant := m.isMultivariant()
+
+	switch tagType {
+	case "version":
+		if m.Version > 0 {
+			return "#EXT-X-VERSION:" + strconv.Itoa(m.Version)
+		}
+
+	case "independent-segments":
+		if m.IndependentSegments {
+			return "#EXT-X-INDEPENDENT-SEGMENTS"
+		}
+
+	case "start":
+		if m.Start != nil {
+			attrs := &attributeList{}
+			attrs.float("TIME-OFFSET", m.Start.TimeOffset)
+			attrs.yes("PRECISE", m.Start.Precise)
+			return w.format("#EXT-X-START", attrs)
+		}
+
+	case "targetduration":
+		if multivariant {
+			return ""
+		}
+		targetDuration := m.TargetDuration
+		if targetDuration == 0 {
+			for _, segment := range m.Segments {
+				if duration := int(math.Round(segment.Duration)); duration > targetDuration {
+					targetDuration = duration
+				}
+			}
+		}
+		return "#EXT-X-TARGETDURATION:" + strconv.Itoa(targetDuration)
+
+	case "media-sequence":
+		if !multivariant && m.MediaSequence != 0 {
+			return "#EXT-X-MEDIA-SEQUENCE:" + strconv.Itoa(m.MediaSequence)
+		}
+
+	case "discontinuity-sequence":
+		if !multivariant && m.DiscontinuitySequence != 0 {
+			return "#EXT-X-DISCONTINUITY-SEQUENCE:" + strconv.Itoa(m.DiscontinuitySequence)
+		}
+
+	case "playlist-type":
+		if !multivariant && m.PlaylistType != "" {
+			return "#EXT-X-PLAYLIST-TYPE:" + m.PlaylistType
+		}
+
+	case "i-frames-only":
+		if !multivariant && m.IFramesOnly {
+			return "#EXT-X-I-FRAMES-ONLY"
+		}
+
+	case "allow-cache":
+		// EXT-X-ALLOW-CACHE was removed in protocol version 7
+		if !multivariant && !m.AllowCache && m.Version < 7 {
+			return "#EXT-X-ALLOW-CACHE:NO"
+		}
+
+	case "server-control":
+		if multivariant || m.ServerControl == nil {
+			return ""
+		}
+		serverControl := m.ServerControl
+		attrs := &attributeList{}
+		if serverControl.CanSkipUntil != 0 {
+			attrs.float("CAN-SKIP-UNTIL", serverControl.CanSkipUntil)
+		}
+		attrs.yes("CAN-SKIP-DATERANGES", serverControl.CanSkipDateRanges)
+		if serverControl.HoldBack != 0 {
+			attrs.float("HOLD-BACK", serverControl.HoldBack)
+		}
+		if serverControl.PartHoldBack != 0 {
+			attrs.float("PART-HOLD-BACK", serverControl.PartHoldBack)
+		}
+		attrs.yes("CAN-BLOCK-RELOAD", serverControl.CanBlockReload)
+		if len(attrs.attrs) > 0 {
+			return w.format("#EXT-X-SERVER-CONTROL", attrs)
+		}
+
+	case "part-inf":
+		if !multivariant && m.PartInf != nil {
+			attrs := &attributeList{}
+			attrs.float("PART-TARGET", m.PartInf.PartTarget)
+			return w.format("#EXT-X-PART-INF", attrs)
+		}
+
+	case "skip":
+		if !multivariant && m.Skip != nil {
+			attrs := &attributeList{}
+			attrs.int("SKIPPED-SEGMENTS", m.Skip.SkippedSegments)
+			if removed := m.Skip.RecentlyRemovedDateRanges; removed != nil {
+				attrs.quoted("RECENTLY-REMOVED-DATERANGES", strings.Join(removed, parsestream.TAB))
+			}
+			return w.format("#EXT-X-SKIP", attrs)
+		}
+
+	case "content-steering":
+		if m.ContentSteering != nil {
+			attrs := &attributeList{}
+			attrs.quoted("SERVER-URI", m.ContentSteering.ServerURI)
+			if m.ContentSteering.PathwayID != "" {
+				attrs.quoted("PATHWAY-ID", m.ContentSteering.PathwayID)
+			}
+			return w.format("#EXT-X-CONTENT-STEERING", attrs)
+		}
+
+	case "endlist":
+		if !multivariant && m.EndList {
+			return "#EXT-X-ENDLIST"
+		}
+	}
+
+	return ""
+}
+
+// writeMultivariant writes the tags of a multivariant playlist
+func (w *playlistWriter) writeMultivariant(m *Manifest) {
+	w.writeCollection(m, "session-data")
+	w.writeCollection(m, "session-key")
+	w.writeTag(m, "content-steering")
+	w.writeCollection(m, "media")
+
+	for i, playlist := range m.Playlists {
+		w.writeVariant(i, playlist, nil)
+	}
+
+	w.writeCollection(m, "i-frame-playlist")
+}
+
+// collectionEntry is the line of an entry of a collection
+type collectionEntry struct {
+	key  entryKey
+	line string
+}
+
+// collection returns the lines of the entries of a collection of the
+// manifest, by the tag type of the entries
+func (w *playlistWriter) collection(m *Manifest, tagType string) []collectionEntry {
+	entries := []collectionEntry{}
+	add := func(key entryKey, name string, attrs *attributeList) {
+		entries = append(entries, collectionEntry{key, w.format(name, attrs)})
+	}
+
+	switch tagType {
+	case "session-data":
+		for _, sessionData := range m.SessionData {
+			attrs := &attributeList{}
+			attrs.quoted("DATA-ID", sessionData.DataID)
+			if sessionData.URI != "" {
+				attrs.quoted("URI", sessionData.URI)
+				if sessionData.Format != "" && sessionData.Format != "JSON" {
+					attrs.enum("FORMAT", sessionData.Format)
+				}
+			} else {
+				attrs.quoted("VALUE", sessionData.Value)
+			}
+			if sessionData.Language != "" {
+				attrs.quoted("LANGUAGE", sessionData.Language)
+			}
+			add(sessionData, "#EXT-X-SESSION-DATA", attrs)
+		}
+
+	case "session-key":
+		for _, key := range m.SessionKeys {
+			add(key, "#EXT-X-SESSION-KEY", keyAttributes(key))
+		}
+
+	case "media":
+		for _, mediaType := range sortedMediaTypes(m.MediaGroups) {
+			groups := m.MediaGroups[mediaType]
+			for _, groupID := range sortedKeys(groups) {
+				renditions := groups[groupID]
+				for _, name := range sortedKeys(renditions) {
+					rendition := renditions[name]
+					attrs := &attributeList{}
+					attrs.enum("TYPE", mediaType)
+					attrs.quoted("GROUP-ID", groupID)
+					attrs.quoted("NAME", name)
+					if rendition.Language != "" {
+						attrs.quoted("LANGUAGE", rendition.Language)
+					}
+					if rendition.StableRenditionID != "" {
+						attrs.quoted("STABLE-RENDITION-ID", rendition.StableRenditionID)
+					}
+					attrs.yes("DEFAULT", rendition.Default)
+					attrs.yes("AUTOSELECT", rendition.Autoselect)
+					attrs.yes("FORCED", rendition.Forced)
+					if rendition.InstreamID != "" {
+						attrs.quoted("INSTREAM-ID", rendition.InstreamID)
+					}
+					if rendition.Characteristics != "" {
+						attrs.quoted("CHARACTERISTICS", rendition.Characteristics)
+					}
+					if rendition.URI != "" {
+						attrs.quoted("URI", rendition.URI)
+					}
+					add(renditionKey{mediaType, groupID, name}, "#EXT-X-MEDIA", attrs)
+				}
+			}
+		}
+
+	case "daterange":
+		for _, dateRange := range m.DateRanges {
+			add(dateRange, "#EXT-X-DATERANGE", dateRangeAttributes(dateRange))
+		}
+
+	case "i-frame-playlist":
+		for i, playlist := range m.IFramePlaylists {
+			if playlist.URI == "" {
+				w.fail("i-frame playlist %d has no URI", i)
+			}
+			attrs := variantAttributes(&playlist.Variant)
+			attrs.quoted("URI", playlist.URI)
+			add(playlist, "#EXT-X-I-FRAME-STREAM-INF", attrs)
+		}
+
+	case "rendition-report":
+		for _, report := range m.RenditionReports {
+			attrs := &attributeList{}
+			attrs.quoted("URI", report.URI)
+			attrs.int("LAST-MSN", report.LastMSN)
+			if report.LastPart >= 0 {
+				attrs.int("LAST-PART", report.LastPart)
+			}
+			add(report, "#EXT-X-RENDITION-REPORT", attrs)
+		}
+	}
+
+	return entries
+}
+
+// writeCollection writes the entries of a collection of the manifest
+func (w *playlistWriter) writeCollection(m *Manifest, tagType string) {
+	for _, entry := range w.collection(m, tagType) {
+		w.line(entry.line)
+	}
+}
+
+// writeVariant writes a variant stream and its URI. The attributes follow
+// their order in the original #EXT-X-STREAM-INF line, if there is one.
+func (w *playlistWriter) writeVariant(index int, playlist *Variant, original *Line) {
+	if playlist.URI == "" {
+		w.fail("variant stream %d has no URI", index)
+	}
+	line := w.format("#EXT-X-STREAM-INF", variantAttributes(playlist))
+	if original != nil {
+		line = keepAttributeOrder(line, original.Text)
+	}
+	w.line(line)
+	w.line(playlist.URI)
+}
+
+// writeMedia writes the tags and segments of a media playlist
+func (w *playlistWriter) writeMedia(m *Manifest) {
+	for _, tagType := range []string{
+		"targetduration", "media-sequence", "discontinuity-sequence", "playlist-type",
+		"i-frames-only", "allow-cache", "server-control", "part-inf", "skip",
+	} {
+		w.writeTag(m, tagType)
+	}
+
+	w.writeCollection(m, "daterange")
+
+	state := &segmentState{}
+	for i, segment := range m.Segments {
+		w.writeSegment(i, segment, state)
+	}
+
+	if m.PreloadSegment != nil {
+		w.writeParts(m.PreloadSegment)
+	}
+
+	w.writeCollection(m, "rendition-report")
+
+	w.writeTag(m, "endlist")
+}
+
+// segmentState is the state carried from one segment to the next: the
+// active keys, the initialization segment and the bitrate
+type segmentState struct {
+	keys    []*Key
+	initMap *Map
+	bitrate int
+}
+
+// stateAfter returns the state after a segment has been written
+func stateAfter(segment *Segment) segmentState {
+	return segmentState{
+		keys:    segment.Keys,
+		initMap: segment.Map,
+		bitrate: segment.Bitrate,
+	}
+}
+
+// restoreState writes the tags needed to change state to target
+func (w *playlistWriter) restoreState(state *segmentState, target segmentState) {
+	if target.initMap != nil && !sameMap(target.initMap, state.initMap) {
+		w.writeKeys(&state.keys, target.initMap.Keys)
+		w.writeMap(target.initMap)
+		state.initMap = target.initMap
+	}
+
+	w.writeKeys(&state.keys, target.keys)
+
+	// #EXT-X-BITRATE:0 resets the bitrate of a previous segment
+	if target.bitrate != state.bitrate {
+		w.line("#EXT-X-BITRATE:" + strconv.Itoa(target.bitrate))
+	}
+	state.bitrate = target.bitrate
+}
+
+// writeSegment writes the tags and URI of a segment, leaving out the keys,
+// initialization segment and bitrate that are already active
+func (w *playlistWriter) writeSegment(index int, segment *Segment, state *segmentState) {
+	if segment.URI == "" {
+		w.fail("segment %d has no URI", index)
+	}
+
+	if segment.Discontinuity {
+		w.line("#EXT-X-DISCONTINUITY")
+	}
+
+	w.restoreState(state, stateAfter(segment))
+
+	if dateTime := formatDateTime(segment.DateTimeString, segment.DateTimeObject); dateTime != "" {
+		w.line("#EXT-X-PROGRAM-DATE-TIME:" + dateTime)
+	}
+
+	if segment.Gap {
+		w.line("#EXT-X-GAP")
+	}
+
+	w.writeCues(segment)
+	w.writeParts(segment)
+
+	if segment.Byterange != nil {
+		w.line("#EXT-X-BYTERANGE:" + formatByterange(segment.Byterange))
+	}
+
+	duration := formatFloat(segment.Duration)
+	if segment.hasZeroDuration() {
+		duration = "0"
+	}
+	w.line("#EXTINF:" + duration + "," + segment.Title)
+	w.line(segment.URI)
+}
+
+// writeMap writes an #EXT-X-MAP tag
+func (w *playlistWriter) writeMap(initMap *Map) {
+	attrs := &attributeList{}
+	attrs.quoted("URI", initMap.URI)
+	if initMap.Byterange != nil {
+		attrs.quoted("BYTERANGE", formatByterange(initMap.Byterange))
+	}
+	w.tag("#EXT-X-MAP", attrs)
+}
+
+// writeKeys writes the #EXT-X-KEY tags needed to change the active keys from
+// *active to keys
+func (w *playlistWriter) writeKeys(active *[]*Key, keys []*Key) {
+	if sameKeys(*active, keys) {
+		return
+	}
+
+	// a key of another KEYFORMAT can only be removed by clearing all keys
+	current := *active
+	for _, key := range current {
+		if findKey(keys, key.KeyFormat) == nil {
+			w.line("#EXT-X-KEY:METHOD=NONE")
+			current = nil
+			break
+		}
+	}
+
+	for _, key := range keys {
+		if previous := findKey(current, key.KeyFormat); previous == nil || !sameKey(previous, key) {
+			w.tag("#EXT-X-KEY", keyAttributes(key))
+		}
+	}
+
+	*active = keys
+}
+
+// writeCues writes the cue tags of a segment
+func (w *playlistWriter) writeCues(segment *Segment) {
+	if segment.CueOut != "" {
+		w.line("#EXT-X-CUE-OUT:" + segment.CueOut)
+	}
+	if segment.CueOutCont != "" {
+		w.line("#EXT-X-CUE-OUT-CONT:" + segment.CueOutCont)
+	}
+	if segment.CueIn != "" {
+		w.line("#EXT-X-CUE-IN:" + segment.CueIn)
+	}
+}
+
+// writeParts writes the partial segments and preload hints of a segment
+func (w *playlistWriter) writeParts(segment *Segment) {
+	for _, part := range segment.Parts {
+		attrs := &attributeList{}
+		attrs.float("DURATION", part.Duration)
+		attrs.quoted("URI", part.URI)
+		attrs.yes("INDEPENDENT", part.Independent)
+		if part.Byterange != nil {
+			attrs.quoted("BYTERANGE", formatByterange(part.Byterange))
+		}
+		attrs.yes("GAP", part.Gap)
+		w.tag("#EXT-X-PART", attrs)
+	}
+
+	for _, hint := range segment.PreloadHints {
+		attrs := &attributeList{}
+		attrs.enum("TYPE", hint.Type)
+		attrs.quoted("URI", hint.URI)
+		if hint.Byterange != nil {
+			if hint.Byterange.Offset != 0 {
+				attrs.int("BYTERANGE-START", hint.Byterange.Offset)
+			}
+			if hint.Byterange.Length != 0 {
+				attrs.int("BYTERANGE-LENGTH", hint.Byterange.Length)
+			}
+		}
+		w.tag("#EXT-X-PRELOAD-HINT", attrs)
+	}
+}
+
+// keyAttributes returns the attributes of #EXT-X-KEY or #EXT-X-SESSION-KEY,
+// omitting KEYFORMAT and KEYFORMATVERSIONS where they have their default values
+func keyAttributes(key *Key) *attributeList {
+	attrs := &attributeList{}
+	attrs.enum("METHOD", string(key.Method))
+	if key.Method == MethodNone {
+		return attrs
+	}
+
+	attrs.quoted("URI", key.URI)
+	if key.IV != "" {
+		iv := key.IV
+		if !strings.HasPrefix(strings.ToLower(iv), "0x") {
+			iv = "0x" + iv
+		}
+		attrs.enum("IV", iv)
+	}
+	if key.KeyFormat != "" && (key.KeyFormat != DefaultKeyFormat || key.Method.IsSampleEncryption()) {
+		attrs.quoted("KEYFORMAT", key.KeyFormat)
+	}
+	if len(key.KeyFormatVersions) > 0 && !(len(key.KeyFormatVersions) == 1 && key.KeyFormatVersions[0] == 1) {
+		versions := make([]string, len(key.KeyFormatVersions))
+		for i, version := range key.KeyFormatVersions {
+			versions[i] = strconv.Itoa(version)
+		}
+		attrs.quoted("KEYFORMATVERSIONS", strings.Join(versions, "/"))
+	}
+	return attrs
+}
+
+// dateRangeAttributes returns the attributes of #EXT-X-DATERANGE
+func dateRangeAttributes(dateRange *DateRange) *attributeList {
+	attrs := &attributeList{}
+	attrs.quoted("ID", dateRange.ID)
+	if dateRange.Class != "" {
+		attrs.quoted("CLASS", dateRange.Class)
+	}
+	attrs.quoted("START-DATE", dateRange.StartDate.Format(dateTimeLayout))
+	if !dateRange.EndDate.IsZero() {
+		attrs.quoted("END-DATE", dateRange.EndDate.Format(dateTimeLayout))
+	}
+	if dateRange.Duration != 0 {
+		attrs.float("DURATION", dateRange.Duration)
+	}
+	if dateRange.PlannedDuration != 0 {
+		attrs.float("PLANNED-DURATION", dateRange.PlannedDuration)
+	}
+
+	for _, name := range sortedKeys(dateRange.CustomAttributes) {
+		switch value := dateRange.CustomAttributes[name].(type) {
+		case float64:
+			attrs.float(name, value)
+		case string:
+			if strings.HasPrefix(strings.ToLower(value), "0x") {
+				attrs.enum(name, value)
+			} else {
+				attrs.quoted(name, value)
+			}
+		default:
+			attrs.quoted(name, fmt.Sprint(value))
+		}
+	}
+
+	if dateRange.SCTE35CMD != "" {
+		attrs.enum("SCTE35-CMD", dateRange.SCTE35CMD)
+	}
+	if dateRange.SCTE35OUT != "" {
+		attrs.enum("SCTE35-OUT", dateRange.SCTE35OUT)
+	}
+	if dateRange.SCTE35IN != "" {
+		attrs.enum("SCTE35-IN", dateRange.SCTE35IN)
+	}
+	attrs.yes("END-ON-NEXT", dateRange.EndOnNext)
+	return attrs
+}
+
+// variantAttributes returns the attributes of a variant stream or i-frame
+// playlist in their usual order, leaving out the URI
+func variantAttributes(variant *Variant) *attributeList {
+	attrs := &attributeList{}
+	values := variant.attributeValues()
+	written := make(map[string]bool)
+
+	for _, name := range variantAttributeOrder {
+		if value, ok := values[name]; ok {
+			attrs.value(name, value)
+			written[name] = true
+		}
+	}
+
+	for _, name := range sortedKeys(values) {
+		if !written[name] {
+			attrs.value(name, values[name])
+		}
+	}
+	return attrs
+}
+
+// attributeList collects the attributes of a tag and the first invalid value
+type attributeList struct {
+	attrs []string
+	err   error
+}
+
+// enum adds an attribute that is written as is
+func (a *attributeList) enum(name, value string) {
+	a.attrs = append(a.attrs, name+"="+value)
+}
+
+// quoted adds a quoted-string attribute, which cannot contain double quotes
+// or line breaks
+func (a *attributeList) quoted(name, value string) {
+	if strings.ContainsAny(value, "\"\r\n") && a.err == nil {
+		a.err = fmt.Errorf("attribute %s cannot be written as a quoted string: %q", name, value)
+	}
+	a.attrs = append(a.attrs, name+"=\""+value+"\"")
+}
+
+// value adds an attribute, quoting it if the attribute is a quoted string
+func (a *attributeList) value(name, value string) {
+	if quotedAttributes[name] && !(name == "CLOSED-CAPTIONS" && value == "NONE") {
+		a.quoted(name, value)
+	} else {
+		a.enum(name, value)
+	}
+}
+
+// int adds a decimal integer attribute
+func (a *attributeList) int(name string, value int) {
+	a.enum(name, strconv.Itoa(value))
+}
+
+// float adds a decimal floating point attribute
+func (a *attributeList) float(name string, value float64) {
+	a.enum(name, formatFloat(value))
+}
+
+// yes adds an enumerated attribute with the value YES if value is true.
+// Attributes that are NO are left out, as this is their default.
+func (a *attributeList) yes(name string, value bool) {
+	if value {
+		a.enum(name, "YES")
+	}
+}
+
+// sameKeys returns true if both lists contain the same keys in the same order
+func sameKeys(a, b []*Key) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !sameKey(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameKey returns true if both keys have the same attributes
+func sameKey(a, b *Key) bool {
+	if a == b {
+		return true
+	}
+	if a.Method != b.Method || a.URI != b.URI || a.IV != b.IV || a.KeyFormat != b.KeyFormat ||
+		len(a.KeyFormatVersions) != len(b.KeyFormatVersions) {
+		return false
+	}
+	for i := range a.KeyFormatVersions {
+		if a.KeyFormatVersions[i] != b.KeyFormatVersions[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameMap returns true if both initialization segments refer to the same resource
+func sameMap(a, b *Map) bool {
+	if a == b {
+		return true
+	}
+	if a == nil || b == nil || a.URI != b.URI {
+		return false
+	}
+	if a.Byterange == nil || b.Byterange == nil {
+		return a.Byterange == b.Byterange
+	}
+	return *a.Byterange == *b.Byterange
+}
+
+// sortedMediaTypes returns the media types of the groups that contain
+// renditions, starting with the types defined by the specification
+func sortedMediaTypes(mediaGroups map[string]map[string]map[string]*MediaGroup) []string {
+	types := []string{}
+	known := map[string]bool{}
+	for _, mediaType := range mediaTypeOrder {
+		known[mediaType] = true
+		if len(mediaGroups[mediaType]) > 0 {
+			types = append(types, mediaType)
+		}
+	}
+	for _, mediaType := range sortedKeys(mediaGroups) {
+		if !known[mediaType] && len(mediaGroups[mediaType]) > 0 {
+			types = append(types, mediaType)
+		}
+	}
+	return types
+}
+
+// sortedKeys returns the keys of a map in alphabetical order
+func sortedKeys[V any](values map[string]V) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatByterange formats a byterange as <length>@<offset>
+func formatByterange(byterange *parsestream.Byterange) string {
+	return strconv.Itoa(byterange.Length) + "@" + strconv.Itoa(byterange.Offset)
+}
+
+// formatDateTime returns the original date time string if present, or the
+// date time formatted with millisecond precision
+func formatDateTime(dateTimeString string, dateTimeObject time.Time) string {
+	if dateTimeString != "" {
+		return dateTimeString
+	}
+	if dateTimeObject.IsZero() {
+		return ""
+	}
+	return dateTimeObject.Format(dateTimeLayout)
+}
+
+// formatFloat formats a decimal floating point number without trailing zeros
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fixtures are the playlists checked in at the root of the repository
+var fixtures = []string{"input.m3u8", "sample.m3u8", "complex.m3u8"}
+
+// readFixture returns the content of a playlist at the root of the repository
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "..", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// parseString parses a complete playlist
+func parseString(t *testing.T, playlist string, opts ...Option) *Manifest {
+	t.Helper()
+	p := New(opts...)
+	p.Push(playlist)
+	if err := p.End(); err != nil {
+		t.Fatal(err)
+	}
+	return p.Manifest
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for _, name := range fixtures {
+		manifest := parseString(t, readFixture(t, name))
+		output, err := manifest.Marshal()
+
+		// complex.m3u8 mixes variant streams and media segments
+		if len(manifest.Playlists) > 0 && len(manifest.Segments) > 0 {
+			if err == nil || !strings.Contains(err.Error(), "both variant streams and media segments") {
+				t.Errorf("%s: got error %v for a playlist with variant streams and media segments", name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		reparsed := parseString(t, string(output))
+		if !reflect.DeepEqual(reparsed, manifest) {
+			t.Errorf("%s: the manifest changed after a round trip:\n%s", name, output)
+		}
+
+		again, err := reparsed.Marshal()
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if string(again) != string(output) {
+			t.Errorf("%s: the output changed after a round trip:\n%s\nwant:\n%s", name, again, output)
+		}
+	}
+}
@@ -2,7 +2,6 @@
 package parsestream
 
 import (
-	"encoding/hex"
 	"regexp"
 	"strconv"
 	"strings"
@@ -299,28 +298,6 @@ func (ps *ParseStream) Push(line string) {
 				attributes := parseAttributes(match[1])
 				event["attributes"] = attributes
 
-				if resolution, ok := attributes["RESOLUTION"]; ok {
-					event["attributes"].(map[string]string)["RESOLUTION"] = resolution
-					resolutionObj := parseResolution(resolution)
-					if resolutionObj.Width != 0 {
-						attributes["RESOLUTION_WIDTH"] = strconv.Itoa(resolutionObj.Width)
-					}
-					if resolutionObj.Height != 0 {
-						attributes["RESOLUTION_HEIGHT"] = strconv.Itoa(resolutionObj.Height)
-					}
-				}
-				if bandwidth, ok := attributes["BANDWIDTH"]; ok {
-					bandwidthInt, _ := strconv.Atoi(bandwidth)
-					attributes["BANDWIDTH"] = strconv.Itoa(bandwidthInt)
-				}
-				if framerate, ok := attributes["FRAME-RATE"]; ok {
-					framerateFloat, _ := strconv.ParseFloat(framerate, 64)
-					attributes["FRAME-RATE"] = strconv.FormatFloat(framerateFloat, 'f', -1, 64)
-				}
-				if programId, ok := attributes["PROGRAM-ID"]; ok {
-					programIdInt, _ := strconv.Atoi(programId)
-					attributes["PROGRAM-ID"] = strconv.Itoa(programIdInt)
-				}
 			}
 			ps.Trigger("data", event)
 			continue
@@ -359,6 +336,30 @@ func (ps *ParseStream) Push(line string) {
 			continue
 		}
 
+		re = regexp.MustCompile(`^#EXT-X-GAP`)
+		if re.MatchString(newLine) {
+			ps.Trigger("data", map[string]interface{}{
+				"type":    "tag",
+				"tagType": "gap",
+			})
+			continue
+		}
+
+		re = regexp.MustCompile(`^#EXT-X-BITRATE:([0-9]*)?`)
+		match = re.FindStringSubmatch(newLine)
+		if len(match) > 0 {
+			event = map[string]interface{}{
+				"type":    "tag",
+				"tagType": "bitrate",
+			}
+			if match[1] != "" {
+				bitrate, _ := strconv.Atoi(match[1])
+				event["bitrate"] = bitrate
+			}
+			ps.Trigger("data", event)
+			continue
+		}
+
 		re = regexp.MustCompile(`^#EXT-X-PROGRAM-DATE-TIME:(.*)$`)
 		match = re.FindStringSubmatch(newLine)
 		if len(match) > 0 {
@@ -385,16 +386,35 @@ func (ps *ParseStream) Push(line string) {
 			if match[1] != "" {
 				attributes := parseAttributes(match[1])
 				event["attributes"] = attributes
+			}
+			ps.Trigger("data", event)
+			continue
+		}
 
-				// parse the IV string into a []byte
-				if iv, ok := attributes["IV"]; ok {
-					if strings.HasPrefix(strings.ToLower(iv), "0x") {
-						iv = iv[2:]
-					}
+		re = regexp.MustCompile(`^#EXT-X-SESSION-KEY:(.*)$`)
+		match = re.FindStringSubmatch(newLine)
+		if len(match) > 0 {
+			event = map[string]interface{}{
+				"type":    "tag",
+				"tagType": "session-key",
+			}
+			if match[1] != "" {
+				attributes := parseAttributes(match[1])
+				event["attributes"] = attributes
+			}
+			ps.Trigger("data", event)
+			continue
+		}
 
-					ivBytes, _ := hex.DecodeString(iv)
-					attributes["IV"] = hex.EncodeToString(ivBytes)
-				}
+		re = regexp.MustCompile(`^#EXT-X-SESSION-DATA:(.*)$`)
+		match = re.FindStringSubmatch(newLine)
+		if len(match) > 0 {
+			event = map[string]interface{}{
+				"type":    "tag",
+				"tagType": "session-data",
+			}
+			if match[1] != "" {
+				event["attributes"] = parseAttributes(match[1])
 			}
 			ps.Trigger("data", event)
 			continue
@@ -524,6 +544,48 @@ func (ps *ParseStream) Push(line string) {
 			continue
 		}
 
+		re = regexp.MustCompile(`^#EXT-X-PRELOAD-HINT:(.*)$`)
+		match = re.FindStringSubmatch(newLine)
+		if len(match) > 0 && match[1] != "" {
+			event = map[string]interface{}{
+				"type":    "tag",
+				"tagType": "preload-hint",
+			}
+			attributes := parseAttributes(match[1])
+			event["attributes"] = attributes
+
+			for _, key := range []string{"BYTERANGE-START", "BYTERANGE-LENGTH"} {
+				if val, ok := attributes[key]; ok {
+					intVal, _ := strconv.Atoi(val)
+					attributes[key] = strconv.Itoa(intVal)
+				}
+			}
+
+			ps.Trigger("data", event)
+			continue
+		}
+
+		re = regexp.MustCompile(`^#EXT-X-RENDITION-REPORT:(.*)$`)
+		match = re.FindStringSubmatch(newLine)
+		if len(match) > 0 && match[1] != "" {
+			event = map[string]interface{}{
+				"type":    "tag",
+				"tagType": "rendition-report",
+			}
+			attributes := parseAttributes(match[1])
+			event["attributes"] = attributes
+
+			for _, key := range []string{"LAST-MSN", "LAST-PART"} {
+				if val, ok := attributes[key]; ok {
+					intVal, _ := strconv.Atoi(val)
+					attributes[key] = strconv.Itoa(intVal)
+				}
+			}
+
+			ps.Trigger("data", event)
+			continue
+		}
+
 		re = regexp.MustCompile(`^#EXT-X-SERVER-CONTROL:(.*)$`)
 		match = re.FindStringSubmatch(newLine)
 		if len(match) > 0 && match[1] != "" {
@@ -570,6 +632,42 @@ func (ps *ParseStream) Push(line string) {
 			continue
 		}
 
+		re = regexp.MustCompile(`^#EXT-X-DATERANGE:(.*)$`)
+		match = re.FindStringSubmatch(newLine)
+		if len(match) > 0 && match[1] != "" {
+			event = map[string]interface{}{
+				"type":       "tag",
+				"tagType":    "daterange",
+				"attributes": parseAttributes(match[1]),
+			}
+			ps.Trigger("data", event)
+			continue
+		}
+
+		re = regexp.MustCompile(`^#EXT-X-CONTENT-STEERING:(.*)$`)
+		match = re.FindStringSubmatch(newLine)
+		if len(match) > 0 && match[1] != "" {
+			event = map[string]interface{}{
+				"type":       "tag",
+				"tagType":    "content-steering",
+				"attributes": parseAttributes(match[1]),
+			}
+			ps.Trigger("data", event)
+			continue
+		}
+
+		re = regexp.MustCompile(`^#EXT-X-DEFINE:(.*)$`)
+		match = re.FindStringSubmatch(newLine)
+		if len(match) > 0 {
+			event = map[string]interface{}{
+				"type":       "tag",
+				"tagType":    "define",
+				"attributes": parseAttributes(match[1]),
+			}
+			ps.Trigger("data", event)
+			continue
+		}
+
 		re = regexp.MustCompile(`^#EXT-X-INDEPENDENT-SEGMENTS`)
 		if re.MatchString(newLine) {
 			ps.Trigger("data", map[string]interface{}{
@@ -604,26 +702,6 @@ func (ps *ParseStream) Push(line string) {
 				if uri, ok := attributes["URI"]; ok {
 					event["uri"] = uri
 				}
-
-				if resolution, ok := attributes["RESOLUTION"]; ok {
-					resolutionObj := parseResolution(resolution)
-					if resolutionObj.Width != 0 {
-						attributes["RESOLUTION_WIDTH"] = strconv.Itoa(resolutionObj.Width)
-					}
-					if resolutionObj.Height != 0 {
-						attributes["RESOLUTION_HEIGHT"] = strconv.Itoa(resolutionObj.Height)
-					}
-				}
-
-				if bandwidth, ok := attributes["BANDWIDTH"]; ok {
-					bandwidthInt, _ := strconv.Atoi(bandwidth)
-					attributes["BANDWIDTH"] = strconv.Itoa(bandwidthInt)
-				}
-
-				if framerate, ok := attributes["FRAME-RATE"]; ok {
-					framerateFloat, _ := strconv.ParseFloat(framerate, 64)
-					attributes["FRAME-RATE"] = strconv.FormatFloat(framerateFloat, 'f', -1, 64)
-				}
 			}
 
 			ps.Trigger("data", event)
@@ -730,21 +808,3 @@ func parseAttributes(attributesString string) map[string]string {
 
 	return result
 }
-
-// parseResolution converts a string into a resolution object
-func parseResolution(resolutionStr string) Resolution {
-	result := Resolution{}
-	parts := strings.Split(resolutionStr, "x")
-
-	if len(parts) > 0 && parts[0] != "" {
-		width, _ := strconv.Atoi(parts[0])
-		result.Width = width
-	}
-
-	if len(parts) > 1 && parts[1] != "" {
-		height, _ := strconv.Atoi(parts[1])
-		result.Height = height
-	}
-
-	return result
-}
@@ -0,0 +1,161 @@
+package pssh
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// PlayReadyHeader represents the Rights Management Header of a PlayReady object
+type PlayReadyHeader struct {
+	// Version is the WRMHEADER version, e.g. 4.0.0.0 or 4.3.0.0
+	Version string
+	// KeyIDs are converted from the little-endian GUIDs of the header
+	// to the big-endian byte order used by PSSH boxes and Widevine
+	KeyIDs []UUID
+	// Algorithm is the ALGID of the keys, e.g. AESCTR or AESCBC
+	Algorithm string
+	LAURL     string
+	LUIURL    string
+	DSID      string
+	// CustomAttributes is the raw XML content of the CUSTOMATTRIBUTES element
+	CustomAttributes string
+	// XML is the complete header as XML
+	XML string
+}
+
+// playReadyRightsManagementHeader is the record type of the Rights Management Header
+const playReadyRightsManagementHeader = 1
+
+// wrmHeader covers the elements of all WRMHEADER versions
+type wrmHeader struct {
+	Version string `xml:"version,attr"`
+	Data    struct {
+		KID         string `xml:"KID"`
+		ProtectInfo struct {
+			AlgID string   `xml:"ALGID"`
+			KID   []wrmKID `xml:"KID"`
+			KIDs  []wrmKID `xml:"KIDS>KID"`
+		} `xml:"PROTECTINFO"`
+		LAURL            string `xml:"LA_URL"`
+		LUIURL           string `xml:"LUI_URL"`
+		DSID             string `xml:"DS_ID"`
+		CustomAttributes struct {
+			Inner string `xml:",innerxml"`
+		} `xml:"CUSTOMATTRIBUTES"`
+	} `xml:"DATA"`
+}
+
+// wrmKID is a KID element of WRMHEADER version 4.1 and later
+type wrmKID struct {
+	AlgID string `xml:"ALGID,attr"`
+	Value string `xml:"VALUE,attr"`
+}
+
+// ParsePlayReadyObject parses a PlayReady object and its Rights Management Header
+func ParsePlayReadyObject(data []byte) (*PlayReadyHeader, error) {
+	if len(data) < 6 {
+		return nil, fmt.Errorf("pssh: PlayReady object too short (%d bytes)", len(data))
+	}
+
+	length := int(binary.LittleEndian.Uint32(data[0:4]))
+	if length > len(data) {
+		return nil, fmt.Errorf("pssh: PlayReady object length %d exceeds %d bytes", length, len(data))
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:6]))
+	offset := 6
+
+	for i := 0; i < count; i++ {
+		if offset+4 > length {
+			return nil, fmt.Errorf("pssh: PlayReady object too short for record %d", i)
+		}
+		recordType := binary.LittleEndian.Uint16(data[offset:])
+		recordLength := int(binary.LittleEndian.Uint16(data[offset+2:]))
+		offset += 4
+
+		if offset+recordLength > length {
+			return nil, fmt.Errorf("pssh: PlayReady record %d exceeds object", i)
+		}
+		record := data[offset : offset+recordLength]
+		offset += recordLength
+
+		if recordType == playReadyRightsManagementHeader {
+			return parseWRMHeader(decodeUTF16LE(record))
+		}
+	}
+
+	return nil, fmt.Errorf("pssh: PlayReady object lacks a Rights Management Header")
+}
+
+// parseWRMHeader parses the XML of a Rights Management Header
+func parseWRMHeader(document string) (*PlayReadyHeader, error) {
+	wrm := wrmHeader{}
+	decoder := xml.NewDecoder(strings.NewReader(document))
+	// the document has already been decoded from UTF-16 regardless of its declaration
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	if err := decoder.Decode(&wrm); err != nil {
+		return nil, fmt.Errorf("pssh: invalid PlayReady header: %w", err)
+	}
+
+	header := &PlayReadyHeader{
+		Version:          wrm.Version,
+		Algorithm:        wrm.Data.ProtectInfo.AlgID,
+		LAURL:            strings.TrimSpace(wrm.Data.LAURL),
+		LUIURL:           strings.TrimSpace(wrm.Data.LUIURL),
+		DSID:             strings.TrimSpace(wrm.Data.DSID),
+		CustomAttributes: wrm.Data.CustomAttributes.Inner,
+		XML:              document,
+	}
+
+	values := []string{}
+	if kid := strings.TrimSpace(wrm.Data.KID); kid != "" {
+		values = append(values, kid)
+	}
+	for _, kid := range append(wrm.Data.ProtectInfo.KID, wrm.Data.ProtectInfo.KIDs...) {
+		values = append(values, kid.Value)
+		if header.Algorithm == "" {
+			header.Algorithm = kid.AlgID
+		}
+	}
+
+	for _, value := range values {
+		keyID, err := decodePlayReadyKID(value)
+		if err != nil {
+			return nil, err
+		}
+		header.KeyIDs = append(header.KeyIDs, keyID)
+	}
+
+	return header, nil
+}
+
+// decodePlayReadyKID decodes a base64 encoded little-endian GUID into a UUID
+func decodePlayReadyKID(value string) (UUID, error) {
+	var keyID UUID
+	guid, err := base64.StdEncoding.DecodeString(strings.TrimSpace(value))
+	if err != nil || len(guid) != len(keyID) {
+		return keyID, fmt.Errorf("pssh: invalid PlayReady KID %q", value)
+	}
+
+	copy(keyID[:], guid)
+	keyID[0], keyID[1], keyID[2], keyID[3] = guid[3], guid[2], guid[1], guid[0]
+	keyID[4], keyID[5] = guid[5], guid[4]
+	keyID[6], keyID[7] = guid[7], guid[6]
+
+	return keyID, nil
+}
+
+// decodeUTF16LE decodes UTF-16LE text, dropping a byte order mark
+func decodeUTF16LE(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return strings.TrimPrefix(string(utf16.Decode(units)), "\ufeff")
+}
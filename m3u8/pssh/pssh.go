@@ -0,0 +1,261 @@
+// Package pssh decodes the data: URIs of #EXT-X-KEY tags into Protection
+// System Specific Header (PSSH) boxes and the Widevine and PlayReady headers
+// they carry
+package pssh
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+// UUID is a 16 byte system or key identifier
+type UUID [16]byte
+
+// String formats the UUID as xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx
+func (u UUID) String() string {
+	h := hex.EncodeToString(u[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+// ParseUUID parses a UUID with or without dashes and an optional urn:uuid: prefix
+func ParseUUID(str string) (UUID, error) {
+	var u UUID
+	str = strings.TrimPrefix(strings.ToLower(str), "urn:uuid:")
+	b, err := hex.DecodeString(strings.Replace(str, "-", "", -1))
+	if err != nil || len(b) != len(u) {
+		return u, fmt.Errorf("pssh: invalid UUID %q", str)
+	}
+	copy(u[:], b)
+	return u, nil
+}
+
+// System IDs of the supported DRM systems
+var (
+	WidevineSystemID  = UUID{0xed, 0xef, 0x8b, 0xa9, 0x79, 0xd6, 0x4a, 0xce, 0xa3, 0xc8, 0x27, 0xdc, 0xd5, 0x1d, 0x21, 0xed}
+	PlayReadySystemID = UUID{0x9a, 0x04, 0xf0, 0x79, 0x98, 0x40, 0x42, 0x86, 0xab, 0x92, 0xe6, 0x5b, 0xe0, 0x88, 0x5f, 0x95}
+)
+
+// KEYFORMAT values of the supported DRM systems
+const (
+	WidevineKeyFormat  = "urn:uuid:edef8ba9-79d6-4ace-a3c8-27dcd51d21ed"
+	PlayReadyKeyFormat = "com.microsoft.playready"
+)
+
+// Box represents a PSSH box
+type Box struct {
+	Version  uint8
+	Flags    uint32
+	SystemID UUID
+	// KeyIDs is only present in version 1 boxes
+	KeyIDs []UUID
+	Data   []byte
+}
+
+// IsWidevine returns true if the box carries Widevine data
+func (b *Box) IsWidevine() bool {
+	return b.SystemID == WidevineSystemID
+}
+
+// IsPlayReady returns true if the box carries a PlayReady object
+func (b *Box) IsPlayReady() bool {
+	return b.SystemID == PlayReadySystemID
+}
+
+// Widevine parses the data of a Widevine box
+func (b *Box) Widevine() (*WidevineHeader, error) {
+	if !b.IsWidevine() {
+		return nil, fmt.Errorf("pssh: system %s is not Widevine", b.SystemID)
+	}
+	return ParseWidevineData(b.Data)
+}
+
+// PlayReady parses the data of a PlayReady box
+func (b *Box) PlayReady() (*PlayReadyHeader, error) {
+	if !b.IsPlayReady() {
+		return nil, fmt.Errorf("pssh: system %s is not PlayReady", b.SystemID)
+	}
+	return ParsePlayReadyObject(b.Data)
+}
+
+// AllKeyIDs returns the key IDs listed in the box and in its Widevine or
+// PlayReady header, without duplicates
+func (b *Box) AllKeyIDs() []UUID {
+	seen := make(map[UUID]bool)
+	result := []UUID{}
+	add := func(keyIDs []UUID) {
+		for _, keyID := range keyIDs {
+			if !seen[keyID] {
+				seen[keyID] = true
+				result = append(result, keyID)
+			}
+		}
+	}
+
+	add(b.KeyIDs)
+	if b.IsWidevine() {
+		if header, err := b.Widevine(); err == nil {
+			add(header.KeyIDs)
+		}
+	}
+	if b.IsPlayReady() {
+		if header, err := b.PlayReady(); err == nil {
+			add(header.KeyIDs)
+		}
+	}
+
+	return result
+}
+
+// ParseBox parses a PSSH box including its box header. Besides the 32-bit
+// size, the header may use a 64-bit largesize (size 1) or extend to the end
+// of data (size 0).
+func ParseBox(data []byte) (*Box, error) {
+	if len(data) < 8 {
+		return nil, fmt.Errorf("pssh: box too short (%d bytes)", len(data))
+	}
+
+	size := uint64(binary.BigEndian.Uint32(data[0:4]))
+	if string(data[4:8]) != "pssh" {
+		return nil, fmt.Errorf("pssh: unexpected box type %q", data[4:8])
+	}
+
+	offset := 8
+	switch size {
+	case 0:
+		size = uint64(len(data))
+	case 1:
+		if len(data) < 16 {
+			return nil, fmt.Errorf("pssh: box too short for largesize")
+		}
+		size = binary.BigEndian.Uint64(data[8:16])
+		offset = 16
+	}
+
+	// version, flags, system ID and data size follow the box header
+	if size > uint64(len(data)) || size < uint64(offset+24) {
+		return nil, fmt.Errorf("pssh: invalid box size %d for %d bytes", size, len(data))
+	}
+	data = data[:size]
+
+	box := &Box{
+		Version: data[offset],
+		Flags:   uint32(data[offset+1])<<16 | uint32(data[offset+2])<<8 | uint32(data[offset+3]),
+	}
+	copy(box.SystemID[:], data[offset+4:offset+20])
+	offset += 20
+
+	if box.Version > 0 {
+		if len(data) < offset+4 {
+			return nil, fmt.Errorf("pssh: box too short for key ID count")
+		}
+		count := int(binary.BigEndian.Uint32(data[offset:]))
+		offset += 4
+
+		if count > (len(data)-offset)/16 {
+			return nil, fmt.Errorf("pssh: box too short for %d key IDs", count)
+		}
+		for i := 0; i < count; i++ {
+			var keyID UUID
+			copy(keyID[:], data[offset:offset+16])
+			box.KeyIDs = append(box.KeyIDs, keyID)
+			offset += 16
+		}
+	}
+
+	if len(data) < offset+4 {
+		return nil, fmt.Errorf("pssh: box too short for data size")
+	}
+	dataSize := int(binary.BigEndian.Uint32(data[offset:]))
+	offset += 4
+
+	if dataSize > len(data)-offset {
+		return nil, fmt.Errorf("pssh: data size %d exceeds box", dataSize)
+	}
+	box.Data = data[offset : offset+dataSize]
+
+	return box, nil
+}
+
+// FromKey decodes the data: URI of a key into a PSSH box. PlayReady keys
+// usually carry a bare PlayReady object instead of a PSSH box; such objects
+// are wrapped into a version 0 PlayReady box.
+func FromKey(key *parser.Key) (*Box, error) {
+	if key == nil {
+		return nil, fmt.Errorf("pssh: no key")
+	}
+
+	data, _, err := DecodeDataURI(key.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) >= 8 && string(data[4:8]) == "pssh" {
+		return ParseBox(data)
+	}
+
+	if isPlayReadyKeyFormat(key.KeyFormat) {
+		if _, err := ParsePlayReadyObject(data); err != nil {
+			return nil, err
+		}
+		return &Box{SystemID: PlayReadySystemID, Data: data}, nil
+	}
+
+	return nil, fmt.Errorf("pssh: key URI of KEYFORMAT %q does not contain a PSSH box", key.KeyFormat)
+}
+
+// isPlayReadyKeyFormat returns true for the KEYFORMAT values used for PlayReady
+func isPlayReadyKeyFormat(keyFormat string) bool {
+	if keyFormat == PlayReadyKeyFormat {
+		return true
+	}
+	systemID, err := ParseUUID(keyFormat)
+	return err == nil && systemID == PlayReadySystemID
+}
+
+// DecodeDataURI decodes a data: URI and returns its data and media type
+func DecodeDataURI(uri string) ([]byte, string, error) {
+	if !strings.HasPrefix(uri, "data:") {
+		return nil, "", fmt.Errorf("pssh: %q is not a data: URI", uri)
+	}
+
+	comma := strings.Index(uri, ",")
+	if comma == -1 {
+		return nil, "", fmt.Errorf("pssh: data: URI lacks data")
+	}
+
+	header := uri[len("data:"):comma]
+	payload := uri[comma+1:]
+
+	mediaType := header
+	isBase64 := false
+	if strings.HasSuffix(header, ";base64") {
+		mediaType = strings.TrimSuffix(header, ";base64")
+		isBase64 = true
+	}
+
+	if !isBase64 {
+		data, err := url.PathUnescape(payload)
+		if err != nil {
+			return nil, "", fmt.Errorf("pssh: %w", err)
+		}
+		return []byte(data), mediaType, nil
+	}
+
+	payload = strings.TrimSpace(payload)
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		// some packagers omit the padding
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+		if err != nil {
+			return nil, "", fmt.Errorf("pssh: %w", err)
+		}
+	}
+
+	return data, mediaType, nil
+}
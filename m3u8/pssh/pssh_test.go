@@ -0,0 +1,237 @@
+package pssh
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+// widevineURI is a version 0 Widevine PSSH box for the key ID
+// 6d76f25cb17f5e16b8eaef6bbf582d8e of the widevine_test provider
+const widevineURI = "data:text/plain;base64,AAAAWnBzc2gAAAAA7e+LqXnWSs6jyCfc1R0h7QAAADoIARIQbXbyXLF/Xha46u9rv1gtjhoNd2lkZXZpbmVfdGVzdCIPZmFrZS1jb250ZW50LWlkSPPGiZsG"
+
+// playReadyURI is a bare PlayReady object with the Rights Management Header of
+// the PlayReady test server content with the key ID 09e36702-8f33-436c-a5dd-60ffe6671e70
+const playReadyURI = "data:text/plain;charset=UTF-16;base64,jAMAAAEAAQCCAzwAVwBSAE0ASABFAEEARABFAFIAIAB4AG0AbABuAHMAPQAiAGgAdAB0AHAAOgAvAC8AcwBjAGgAZQBtAGEAcwAuAG0AaQBjAHIAbwBzAG8AZgB0AC4AYwBvAG0ALwBEAFIATQAvADIAMAAwADcALwAwADMALwBQAGwAYQB5AFIAZQBhAGQAeQBIAGUAYQBkAGUAcgAiACAAdgBlAHIAcwBpAG8AbgA9ACIANAAuADAALgAwAC4AMAAiAD4APABEAEEAVABBAD4APABQAFIATwBUAEUAQwBUAEkATgBGAE8APgA8AEsARQBZAEwARQBOAD4AMQA2ADwALwBLAEUAWQBMAEUATgA+ADwAQQBMAEcASQBEAD4AQQBFAFMAQwBUAFIAPAAvAEEATABHAEkARAA+ADwALwBQAFIATwBUAEUAQwBUAEkATgBGAE8APgA8AEsASQBEAD4AQQBtAGYAagBDAFQATwBQAGIARQBPAGwAMwBXAEQALwA1AG0AYwBlAGMAQQA9AD0APAAvAEsASQBEAD4APABDAEgARQBDAEsAUwBVAE0APgBCAEcAdwAxAGEAWQBaADEAWQBYAE0APQA8AC8AQwBIAEUAQwBLAFMAVQBNAD4APABDAFUAUwBUAE8ATQBBAFQAVABSAEkAQgBVAFQARQBTAD4APABJAEkAUwBfAEQAUgBNAF8AVgBFAFIAUwBJAE8ATgA+ADcALgAxAC4AMQAwADYANAAuADAAPAAvAEkASQBTAF8ARABSAE0AXwBWAEUAUgBTAEkATwBOAD4APAAvAEMAVQBTAFQATwBNAEEAVABUAFIASQBCAFUAVABFAFMAPgA8AEwAQQBfAFUAUgBMAD4AaAB0AHQAcAA6AC8ALwBwAGwAYQB5AHIAZQBhAGQAeQAuAGQAaQByAGUAYwB0AHQAYQBwAHMALgBuAGUAdAAvAHAAcgAvAHMAdgBjAC8AcgBpAGcAaAB0AHMAbQBhAG4AYQBnAGUAcgAuAGEAcwBtAHgAPAAvAEwAQQBfAFUAUgBMAD4APABEAFMAXwBJAEQAPgBBAEgAKwAwADMAagB1AEsAYgBVAEcAYgBIAGwAMQBWAC8AUQBJAHcAUgBBAD0APQA8AC8ARABTAF8ASQBEAD4APAAvAEQAQQBUAEEAPgA8AC8AVwBSAE0ASABFAEEARABFAFIAPgA="
+
+var (
+	widevineKeyID  = mustParseUUID("6d76f25c-b17f-5e16-b8ea-ef6bbf582d8e")
+	playReadyKeyID = mustParseUUID("09e36702-8f33-436c-a5dd-60ffe6671e70")
+)
+
+func mustParseUUID(str string) UUID {
+	u, err := ParseUUID(str)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+// decode returns the data of a data: URI
+func decode(t *testing.T, uri string) []byte {
+	t.Helper()
+	data, _, err := DecodeDataURI(uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// parseKeys returns the keys of the first segment of a media playlist
+func parseKeys(t *testing.T, keyTags string) []*parser.Key {
+	t.Helper()
+	p := parser.New()
+	p.Push("#EXTM3U\n#EXT-X-VERSION:5\n#EXT-X-TARGETDURATION:10\n" + keyTags + "#EXTINF:10,\nsegment.ts\n#EXT-X-ENDLIST\n")
+	if err := p.End(); err != nil {
+		t.Fatal(err)
+	}
+	return p.Manifest.Segments[0].Keys
+}
+
+func TestParseUUID(t *testing.T) {
+	for _, str := range []string{
+		"6d76f25c-b17f-5e16-b8ea-ef6bbf582d8e",
+		"6D76F25CB17F5E16B8EAEF6BBF582D8E",
+		"urn:uuid:6d76f25c-b17f-5e16-b8ea-ef6bbf582d8e",
+	} {
+		u, err := ParseUUID(str)
+		if err != nil || u.String() != "6d76f25c-b17f-5e16-b8ea-ef6bbf582d8e" {
+			t.Errorf("%s: got %s, %v", str, u, err)
+		}
+	}
+
+	if _, err := ParseUUID("6d76f25c"); err == nil {
+		t.Error("expected an error for a short UUID")
+	}
+}
+
+func TestDecodeDataURI(t *testing.T) {
+	tests := []struct {
+		uri       string
+		data      string
+		mediaType string
+		err       bool
+	}{
+		{"data:text/plain;base64,aGVsbG8=", "hello", "text/plain", false},
+		{"data:;base64,aGVsbG8", "hello", "", false},
+		{"data:text/plain,hello%20world", "hello world", "text/plain", false},
+		{"skd://key", "", "", true},
+		{"data:text/plain;base64", "", "", true},
+		{"data:;base64,!!!", "", "", true},
+	}
+
+	for _, test := range tests {
+		data, mediaType, err := DecodeDataURI(test.uri)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.uri)
+			}
+			continue
+		}
+		if err != nil || string(data) != test.data || mediaType != test.mediaType {
+			t.Errorf("%s: got %q, %q, %v", test.uri, data, mediaType, err)
+		}
+	}
+}
+
+func TestParseBox(t *testing.T) {
+	box := decode(t, widevineURI)
+	body := box[8:]
+
+	// the same box with a 64-bit largesize and with a size of 0
+	largesize := append([]byte{0, 0, 0, 1, 'p', 's', 's', 'h'}, binary.BigEndian.AppendUint64(nil, uint64(len(box)+8))...)
+	largesize = append(largesize, body...)
+	toEnd := append([]byte{0, 0, 0, 0, 'p', 's', 's', 'h'}, body...)
+
+	// a version 1 box listing two key IDs without data, followed by another box
+	version1 := []byte{0, 0, 0, 68, 'p', 's', 's', 'h', 1, 0, 0, 0}
+	version1 = append(version1, WidevineSystemID[:]...)
+	version1 = append(version1, 0, 0, 0, 2)
+	version1 = append(version1, widevineKeyID[:]...)
+	version1 = append(version1, playReadyKeyID[:]...)
+	version1 = append(version1, 0, 0, 0, 0)
+	version1 = append(version1, box...)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		version uint8
+		keyIDs  []UUID
+		dataLen int
+	}{
+		{"32-bit size", box, 0, nil, 58},
+		{"largesize", largesize, 0, nil, 58},
+		{"size 0", toEnd, 0, nil, 58},
+		{"version 1", version1, 1, []UUID{widevineKeyID, playReadyKeyID}, 0},
+	}
+
+	for _, test := range tests {
+		parsed, err := ParseBox(test.data)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !parsed.IsWidevine() || parsed.Version != test.version || !reflect.DeepEqual(parsed.KeyIDs, test.keyIDs) || len(parsed.Data) != test.dataLen {
+			t.Errorf("%s: got %+v", test.name, parsed)
+		}
+	}
+
+	invalid := map[string][]byte{
+		"truncated":           box[:len(box)-1],
+		"short header":        box[:6],
+		"size below minimum":  append([]byte{0, 0, 0, 31}, box[4:]...),
+		"largesize too large": append(append([]byte{0, 0, 0, 1, 'p', 's', 's', 'h'}, binary.BigEndian.AppendUint64(nil, 1<<40)...), body...),
+		"wrong type":          append(append([]byte{}, box[:4]...), append([]byte("moov"), box[8:]...)...),
+		"data size":           append(append([]byte{}, box[:28]...), append([]byte{0, 0, 0, 59}, box[32:]...)...),
+	}
+	for name, data := range invalid {
+		if _, err := ParseBox(data); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseWidevineData(t *testing.T) {
+	box, err := ParseBox(decode(t, widevineURI))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, err := box.Widevine()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &WidevineHeader{
+		Algorithm:        1,
+		KeyIDs:           []UUID{widevineKeyID},
+		Provider:         "widevine_test",
+		ContentID:        []byte("fake-content-id"),
+		ProtectionScheme: "cbcs",
+	}
+	if !reflect.DeepEqual(header, want) {
+		t.Errorf("got %+v, want %+v", header, want)
+	}
+
+	if _, err := ParseWidevineData(box.Data[:len(box.Data)-2]); err == nil {
+		t.Error("expected an error for truncated data")
+	}
+	if _, err := box.PlayReady(); err == nil {
+		t.Error("expected an error for a PlayReady header of a Widevine box")
+	}
+}
+
+func TestParsePlayReadyObject(t *testing.T) {
+	data := decode(t, playReadyURI)
+	header, err := ParsePlayReadyObject(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if header.Version != "4.0.0.0" || header.Algorithm != "AESCTR" ||
+		!reflect.DeepEqual(header.KeyIDs, []UUID{playReadyKeyID}) ||
+		header.LAURL != "http://playready.directtaps.net/pr/svc/rightsmanager.asmx" ||
+		header.DSID != "AH+03juKbUGbHl1V/QIwRA==" ||
+		header.CustomAttributes != "<IIS_DRM_VERSION>7.1.1064.0</IIS_DRM_VERSION>" ||
+		!strings.HasPrefix(header.XML, "<WRMHEADER") {
+		t.Errorf("got %+v", header)
+	}
+
+	if _, err := ParsePlayReadyObject(data[:len(data)-2]); err == nil {
+		t.Error("expected an error for a truncated object")
+	}
+}
+
+func TestFromKey(t *testing.T) {
+	keys := parseKeys(t, `#EXT-X-KEY:METHOD=SAMPLE-AES,URI="`+widevineURI+`",KEYFORMAT="`+WidevineKeyFormat+`",KEYFORMATVERSIONS="1"
+#EXT-X-KEY:METHOD=SAMPLE-AES-CTR,URI="`+playReadyURI+`",KEYFORMAT="`+PlayReadyKeyFormat+`",KEYFORMATVERSIONS="1"
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="data:;base64,`+base64.StdEncoding.EncodeToString([]byte("not a box"))+`",KEYFORMAT="identity"
+`)
+
+	widevine, err := FromKey(keys[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(widevine.AllKeyIDs(), []UUID{widevineKeyID}) {
+		t.Errorf("got Widevine key IDs %v", widevine.AllKeyIDs())
+	}
+
+	playReady, err := FromKey(keys[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !playReady.IsPlayReady() || !bytes.Equal(playReady.Data, decode(t, playReadyURI)) {
+		t.Errorf("got PlayReady box %+v", playReady)
+	}
+	if !reflect.DeepEqual(playReady.AllKeyIDs(), []UUID{playReadyKeyID}) {
+		t.Errorf("got PlayReady key IDs %v", playReady.AllKeyIDs())
+	}
+
+	if _, err := FromKey(keys[2]); err == nil {
+		t.Error("expected an error for a key without PSSH box")
+	}
+}
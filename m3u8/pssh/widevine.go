@@ -0,0 +1,100 @@
+package pssh
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// WidevineHeader represents the WidevinePsshData carried in a Widevine PSSH box
+type WidevineHeader struct {
+	// Algorithm is 0 for unencrypted and 1 for AES-CTR, deprecated in favour of ProtectionScheme
+	Algorithm         int
+	KeyIDs            []UUID
+	Provider          string
+	ContentID         []byte
+	Policy            string
+	CryptoPeriodIndex uint32
+	// ProtectionScheme is the four character code of the scheme, e.g. cenc or cbcs
+	ProtectionScheme string
+}
+
+// protobuf wire types used by WidevinePsshData
+const (
+	wireVarint = 0
+	wireBytes  = 2
+	wireFixed  = 5
+)
+
+// ParseWidevineData parses the protobuf encoded WidevinePsshData
+func ParseWidevineData(data []byte) (*WidevineHeader, error) {
+	header := &WidevineHeader{}
+
+	for len(data) > 0 {
+		tag, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, fmt.Errorf("pssh: invalid Widevine field tag")
+		}
+		data = data[n:]
+
+		field := tag >> 3
+		switch tag & 7 {
+		case wireVarint:
+			value, n := binary.Uvarint(data)
+			if n <= 0 {
+				return nil, fmt.Errorf("pssh: invalid Widevine field %d", field)
+			}
+			data = data[n:]
+
+			switch field {
+			case 1:
+				header.Algorithm = int(value)
+			case 7:
+				header.CryptoPeriodIndex = uint32(value)
+			case 9:
+				header.ProtectionScheme = fourCC(uint32(value))
+			}
+
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || length > uint64(len(data)-n) {
+				return nil, fmt.Errorf("pssh: invalid Widevine field %d", field)
+			}
+			value := data[n : n+int(length)]
+			data = data[n+int(length):]
+
+			switch field {
+			case 2:
+				if len(value) != 16 {
+					return nil, fmt.Errorf("pssh: invalid Widevine key ID length %d", len(value))
+				}
+				var keyID UUID
+				copy(keyID[:], value)
+				header.KeyIDs = append(header.KeyIDs, keyID)
+			case 3:
+				header.Provider = string(value)
+			case 4:
+				header.ContentID = value
+			case 6:
+				header.Policy = string(value)
+			}
+
+		case wireFixed:
+			if len(data) < 4 {
+				return nil, fmt.Errorf("pssh: invalid Widevine field %d", field)
+			}
+			data = data[4:]
+
+		default:
+			return nil, fmt.Errorf("pssh: unsupported wire type %d in Widevine field %d", tag&7, field)
+		}
+	}
+
+	return header, nil
+}
+
+// fourCC converts a big-endian four character code to a string
+func fourCC(value uint32) string {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, value)
+	return string(b)
+}
@@ -0,0 +1,326 @@
+// Package steering provides content steering support: parsing of the JSON
+// steering manifest referenced by #EXT-X-CONTENT-STEERING and selection of
+// the variant streams of the active pathway
+package steering
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+// DefaultPathwayID is the pathway of variant streams without a PATHWAY-ID attribute
+const DefaultPathwayID = "."
+
+// Manifest represents a steering manifest
+type Manifest struct {
+	Version int `json:"VERSION"`
+	// TTL is the number of seconds before the manifest should be reloaded
+	TTL             int            `json:"TTL"`
+	ReloadURI       string         `json:"RELOAD-URI,omitempty"`
+	PathwayPriority []string       `json:"PATHWAY-PRIORITY"`
+	PathwayClones   []PathwayClone `json:"PATHWAY-CLONES,omitempty"`
+}
+
+// PathwayClone represents a pathway that is created by copying the variant
+// streams of an existing pathway and replacing their URIs
+type PathwayClone struct {
+	BaseID         string         `json:"BASE-ID"`
+	ID             string         `json:"ID"`
+	URIReplacement URIReplacement `json:"URI-REPLACEMENT"`
+}
+
+// URIReplacement describes how the URIs of a cloned pathway are derived
+type URIReplacement struct {
+	Host             string            `json:"HOST,omitempty"`
+	Params           map[string]string `json:"PARAMS,omitempty"`
+	PerVariantURIs   map[string]string `json:"PER-VARIANT-URIS,omitempty"`
+	PerRenditionURIs map[string]string `json:"PER-RENDITION-URIS,omitempty"`
+}
+
+// Parse parses a steering manifest
+func Parse(data []byte) (*Manifest, error) {
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("steering manifest: %w", err)
+	}
+
+	if manifest.Version != 1 {
+		return nil, fmt.Errorf("steering manifest: unsupported VERSION %d", manifest.Version)
+	}
+
+	if manifest.TTL <= 0 {
+		return nil, fmt.Errorf("steering manifest: missing or invalid TTL")
+	}
+
+	if len(manifest.PathwayPriority) == 0 {
+		return nil, fmt.Errorf("steering manifest: missing PATHWAY-PRIORITY")
+	}
+
+	for i, clone := range manifest.PathwayClones {
+		if clone.BaseID == "" || clone.ID == "" {
+			return nil, fmt.Errorf("steering manifest: PATHWAY-CLONES #%d lacks BASE-ID or ID", i)
+		}
+	}
+
+	return manifest, nil
+}
+
+// PathwayVariants applies the pathway clones to a multivariant playlist and
+// returns the active pathway together with a copy of the playlist that is
+// limited to the variant streams and i-frame playlists of that pathway and
+// includes the cloned renditions. The active pathway is the first entry of
+// PATHWAY-PRIORITY that has variant streams, or current if there is none.
+// baseURI is the URI of the multivariant playlist and is used to resolve
+// relative URIs when cloning.
+func (m *Manifest) PathwayVariants(playlist *parser.Manifest, baseURI, current string) (string, *parser.Manifest) {
+	cloned := m.ApplyClones(playlist, baseURI)
+
+	byPathway := make(map[string][]*parser.Variant)
+	for _, variant := range cloned.Playlists {
+		pathway := PathwayID(variant)
+		byPathway[pathway] = append(byPathway[pathway], variant)
+	}
+
+	active := current
+	for _, pathway := range m.PathwayPriority {
+		if _, ok := byPathway[pathway]; ok {
+			active = pathway
+			break
+		}
+	}
+
+	cloned.Playlists = byPathway[active]
+
+	iFramePlaylists := []*parser.IFramePlaylist{}
+	for _, iFramePlaylist := range cloned.IFramePlaylists {
+		if PathwayID(&iFramePlaylist.Variant) == active {
+			iFramePlaylists = append(iFramePlaylists, iFramePlaylist)
+		}
+	}
+	cloned.IFramePlaylists = iFramePlaylists
+
+	return active, cloned
+}
+
+// ApplyClones returns a copy of a multivariant playlist whose variant streams
+// and i-frame playlists are extended by a copy of those of the base pathway
+// for every pathway clone. The audio, video and subtitle renditions they use
+// are copied into new groups, named after the base group and the clone, e.g.
+// "aac" becomes "aac_clone_cdn-b". Clones whose base pathway has no variant
+// streams or whose ID is already in use are ignored.
+func (m *Manifest) ApplyClones(playlist *parser.Manifest, baseURI string) *parser.Manifest {
+	result := *playlist
+	result.Playlists = append([]*parser.Variant{}, playlist.Playlists...)
+	result.IFramePlaylists = append([]*parser.IFramePlaylist{}, playlist.IFramePlaylists...)
+	result.MediaGroups = make(map[string]map[string]map[string]*parser.MediaGroup, len(playlist.MediaGroups))
+	for mediaType, groups := range playlist.MediaGroups {
+		result.MediaGroups[mediaType] = make(map[string]map[string]*parser.MediaGroup, len(groups))
+		for groupID, group := range groups {
+			result.MediaGroups[mediaType][groupID] = group
+		}
+	}
+
+	for _, clone := range m.PathwayClones {
+		pathways := make(map[string]bool)
+		for _, variant := range result.Playlists {
+			pathways[PathwayID(variant)] = true
+		}
+
+		if !pathways[clone.BaseID] || pathways[clone.ID] {
+			continue
+		}
+
+		for _, variant := range result.Playlists {
+			if PathwayID(variant) == clone.BaseID {
+				cloned := clone.cloneVariant(variant, result.MediaGroups, baseURI)
+				result.Playlists = append(result.Playlists, &cloned)
+			}
+		}
+
+		for _, iFramePlaylist := range result.IFramePlaylists {
+			if PathwayID(&iFramePlaylist.Variant) == clone.BaseID {
+				result.IFramePlaylists = append(result.IFramePlaylists, &parser.IFramePlaylist{
+					Variant:  clone.cloneVariant(&iFramePlaylist.Variant, result.MediaGroups, baseURI),
+					Timeline: iFramePlaylist.Timeline,
+				})
+			}
+		}
+	}
+
+	return &result
+}
+
+// cloneVariant returns a copy of a variant stream or i-frame playlist of the
+// base pathway that belongs to the clone, cloning the groups it uses
+func (c PathwayClone) cloneVariant(variant *parser.Variant, groups map[string]map[string]map[string]*parser.MediaGroup, baseURI string) parser.Variant {
+	cloned := *variant
+	cloned.Attributes = make(map[string]string)
+	for k, v := range variant.Attributes {
+		cloned.Attributes[k] = v
+	}
+	cloned.Attributes["PATHWAY-ID"] = c.ID
+	cloned.PathwayID = c.ID
+	cloned.URI = c.URIReplacement.VariantURI(parser.ResolveURI(baseURI, variant.URI), variant.StableVariantID)
+	// the retained lines belong to the original variant stream
+	cloned.Lines = nil
+
+	// the GROUP-ID attributes are named after the TYPE of the renditions
+	for mediaType, groupID := range map[string]*string{
+		"AUDIO":     &cloned.Audio,
+		"VIDEO":     &cloned.Video,
+		"SUBTITLES": &cloned.Subtitles,
+	} {
+		if *groupID == "" {
+			continue
+		}
+		*groupID = c.cloneGroup(groups[mediaType], *groupID, baseURI)
+		cloned.Attributes[mediaType] = *groupID
+	}
+
+	return cloned
+}
+
+// cloneGroup copies the renditions of a group into the group of the clone
+// unless an earlier variant stream already did, and returns the GROUP-ID of
+// the copy. Groups that do not exist are not copied.
+func (c PathwayClone) cloneGroup(groups map[string]map[string]*parser.MediaGroup, groupID, baseURI string) string {
+	renditions, ok := groups[groupID]
+	if !ok {
+		return groupID
+	}
+
+	clonedID := groupID + "_clone_" + c.ID
+	if _, ok := groups[clonedID]; ok {
+		return clonedID
+	}
+
+	cloned := make(map[string]*parser.MediaGroup, len(renditions))
+	for name, rendition := range renditions {
+		copied := *rendition
+		if copied.URI != "" {
+			copied.URI = c.URIReplacement.RenditionURI(parser.ResolveURI(baseURI, rendition.URI), rendition.StableRenditionID)
+		}
+		cloned[name] = &copied
+	}
+	groups[clonedID] = cloned
+	return clonedID
+}
+
+// VariantURI returns the URI of a variant stream in a cloned pathway
+func (r URIReplacement) VariantURI(uri, stableVariantID string) string {
+	return r.replace(uri, stableVariantID, r.PerVariantURIs)
+}
+
+// RenditionURI returns the URI of a rendition in a cloned pathway
+func (r URIReplacement) RenditionURI(uri, stableRenditionID string) string {
+	return r.replace(uri, stableRenditionID, r.PerRenditionURIs)
+}
+
+// replace applies the replacement rules to uri, preferring an explicit URI for stableID
+func (r URIReplacement) replace(uri, stableID string, perURIs map[string]string) string {
+	if stableID != "" {
+		if replacement, ok := perURIs[stableID]; ok {
+			return replacement
+		}
+	}
+
+	parsedURL, err := url.Parse(uri)
+	if err != nil {
+		return uri
+	}
+
+	if r.Host != "" {
+		parsedURL.Host = r.Host
+	}
+
+	if len(r.Params) > 0 {
+		query := parsedURL.Query()
+		for k, v := range r.Params {
+			query.Set(k, v)
+		}
+		parsedURL.RawQuery = query.Encode()
+	}
+
+	return parsedURL.String()
+}
+
+// PathwayID returns the pathway of a variant stream
+func PathwayID(variant *parser.Variant) string {
+	if variant.PathwayID != "" {
+		return variant.PathwayID
+	}
+	return DefaultPathwayID
+}
+
+// Client loads steering manifests from a steering server
+type Client struct {
+	HTTPClient *http.Client
+	// URI is the URI the next steering manifest is requested from. It starts
+	// out as the SERVER-URI and follows the RELOAD-URI of each manifest.
+	URI string
+}
+
+// NewClient creates a new Client for the content steering server of a
+// multivariant playlist. baseURI is the URI of the multivariant playlist.
+func NewClient(contentSteering *parser.ContentSteering, baseURI string) *Client {
+	return &Client{
+		HTTPClient: http.DefaultClient,
+		URI:        parser.ResolveURI(baseURI, contentSteering.ServerURI),
+	}
+}
+
+// Fetch requests the steering manifest, reporting the current pathway and the
+// measured throughput in bits per second (omitted when zero) to the server
+func (c *Client) Fetch(ctx context.Context, pathway string, throughput int) (*Manifest, error) {
+	requestURL, err := url.Parse(c.URI)
+	if err != nil {
+		return nil, fmt.Errorf("steering manifest: %w", err)
+	}
+
+	query := requestURL.Query()
+	if pathway != "" {
+		query.Set("_HLS_pathway", pathway)
+	}
+	if throughput > 0 {
+		query.Set("_HLS_throughput", strconv.Itoa(throughput))
+	}
+	requestURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("steering manifest: %w", err)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("steering manifest: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("steering manifest: unexpected status %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("steering manifest: %w", err)
+	}
+
+	manifest, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if manifest.ReloadURI != "" {
+		c.URI = parser.ResolveURI(c.URI, manifest.ReloadURI)
+	}
+
+	return manifest, nil
+}
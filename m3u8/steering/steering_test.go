@@ -0,0 +1,187 @@
+package steering
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+const multivariant = `#EXTM3U
+#EXT-X-CONTENT-STEERING:SERVER-URI="steering.json",PATHWAY-ID="cdn-a"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,URI="audio/en.m3u8",STABLE-RENDITION-ID="en"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO="aac",PATHWAY-ID="cdn-a",STABLE-VARIANT-ID="low"
+video/low.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,AUDIO="aac",PATHWAY-ID="cdn-a",STABLE-VARIANT-ID="high"
+video/high.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,PATHWAY-ID="cdn-c"
+https://c.example.com/video/low.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=86000,PATHWAY-ID="cdn-a",URI="video/iframes.m3u8"
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=86000,PATHWAY-ID="cdn-c",URI="https://c.example.com/video/iframes.m3u8"
+`
+
+const baseURI = "https://a.example.com/main.m3u8"
+
+func parseMultivariant(t *testing.T) *parser.Manifest {
+	t.Helper()
+	p := parser.New()
+	p.Push(multivariant)
+	if err := p.End(); err != nil {
+		t.Fatal(err)
+	}
+	return p.Manifest
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		// err is a substring of the error, empty if the manifest is valid
+		err string
+	}{
+		{"valid", `{"VERSION":1,"TTL":300,"PATHWAY-PRIORITY":["cdn-a","cdn-b"]}`, ""},
+		{"malformed", `{"VERSION":1,`, "unexpected end"},
+		{"version", `{"VERSION":2,"TTL":300,"PATHWAY-PRIORITY":["cdn-a"]}`, "unsupported VERSION 2"},
+		{"missing TTL", `{"VERSION":1,"PATHWAY-PRIORITY":["cdn-a"]}`, "invalid TTL"},
+		{"missing PATHWAY-PRIORITY", `{"VERSION":1,"TTL":300}`, "missing PATHWAY-PRIORITY"},
+		{"clone without ID", `{"VERSION":1,"TTL":300,"PATHWAY-PRIORITY":["cdn-a"],"PATHWAY-CLONES":[{"BASE-ID":"cdn-a"}]}`, "lacks BASE-ID or ID"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse([]byte(test.data))
+		if test.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestURIReplacement(t *testing.T) {
+	replacement := URIReplacement{
+		Host:             "b.example.com",
+		Params:           map[string]string{"token": "b"},
+		PerVariantURIs:   map[string]string{"high": "https://d.example.com/high.m3u8"},
+		PerRenditionURIs: map[string]string{"en": "https://d.example.com/en.m3u8"},
+	}
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"host and params", replacement.VariantURI("https://a.example.com/video/low.m3u8?session=1", "low"), "https://b.example.com/video/low.m3u8?session=1&token=b"},
+		{"per-variant URI", replacement.VariantURI("https://a.example.com/video/high.m3u8", "high"), "https://d.example.com/high.m3u8"},
+		{"per-rendition URI", replacement.RenditionURI("https://a.example.com/audio/en.m3u8", "en"), "https://d.example.com/en.m3u8"},
+		{"rendition without stable ID", replacement.RenditionURI("https://a.example.com/audio/fr.m3u8", ""), "https://b.example.com/audio/fr.m3u8?token=b"},
+	}
+
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestApplyClones(t *testing.T) {
+	playlist := parseMultivariant(t)
+	manifest := &Manifest{
+		Version:         1,
+		TTL:             300,
+		PathwayPriority: []string{"cdn-b", "cdn-a"},
+		PathwayClones: []PathwayClone{
+			{BaseID: "cdn-a", ID: "cdn-b", URIReplacement: URIReplacement{Host: "b.example.com"}},
+			// clones of an unknown pathway or onto an existing one are ignored
+			{BaseID: "cdn-x", ID: "cdn-y"},
+			{BaseID: "cdn-a", ID: "cdn-c"},
+		},
+	}
+
+	cloned := manifest.ApplyClones(playlist, baseURI)
+	if len(playlist.Playlists) != 3 || len(playlist.IFramePlaylists) != 2 || len(playlist.MediaGroups["AUDIO"]) != 1 {
+		t.Fatal("the original playlist was modified")
+	}
+
+	wantVariants := []string{
+		"video/low.m3u8",
+		"video/high.m3u8",
+		"https://c.example.com/video/low.m3u8",
+		"https://b.example.com/video/low.m3u8",
+		"https://b.example.com/video/high.m3u8",
+	}
+	if len(cloned.Playlists) != len(wantVariants) {
+		t.Fatalf("got %d variant streams, want %d", len(cloned.Playlists), len(wantVariants))
+	}
+	for i, want := range wantVariants {
+		if cloned.Playlists[i].URI != want {
+			t.Errorf("variant stream %d: got URI %s, want %s", i, cloned.Playlists[i].URI, want)
+		}
+	}
+	for _, variant := range cloned.Playlists[3:] {
+		if variant.PathwayID != "cdn-b" || variant.Attributes["PATHWAY-ID"] != "cdn-b" {
+			t.Errorf("%s: got pathway %s, want cdn-b", variant.URI, variant.PathwayID)
+		}
+		if variant.Audio != "aac_clone_cdn-b" || variant.Attributes["AUDIO"] != "aac_clone_cdn-b" {
+			t.Errorf("%s: got audio group %s, want aac_clone_cdn-b", variant.URI, variant.Audio)
+		}
+	}
+
+	rendition := cloned.MediaGroups["AUDIO"]["aac_clone_cdn-b"]["English"]
+	if rendition == nil || rendition.URI != "https://b.example.com/audio/en.m3u8" {
+		t.Errorf("got cloned rendition %+v", rendition)
+	}
+
+	if len(cloned.IFramePlaylists) != 3 {
+		t.Fatalf("got %d i-frame playlists, want 3", len(cloned.IFramePlaylists))
+	}
+	iFrames := cloned.IFramePlaylists[2]
+	if iFrames.PathwayID != "cdn-b" || iFrames.URI != "https://b.example.com/video/iframes.m3u8" {
+		t.Errorf("got cloned i-frame playlist %s on pathway %s", iFrames.URI, iFrames.PathwayID)
+	}
+}
+
+func TestPathwayVariants(t *testing.T) {
+	playlist := parseMultivariant(t)
+	clones := []PathwayClone{{BaseID: "cdn-a", ID: "cdn-b", URIReplacement: URIReplacement{Host: "b.example.com"}}}
+
+	tests := []struct {
+		name     string
+		priority []string
+		clones   []PathwayClone
+		want     string
+		variants int
+		iFrames  []string
+	}{
+		{"first pathway", []string{"cdn-c", "cdn-a"}, nil, "cdn-c", 1, []string{"https://c.example.com/video/iframes.m3u8"}},
+		{"unknown pathway skipped", []string{"cdn-x", "cdn-a"}, nil, "cdn-a", 2, []string{"video/iframes.m3u8"}},
+		{"cloned pathway", []string{"cdn-b", "cdn-a"}, clones, "cdn-b", 2, []string{"https://b.example.com/video/iframes.m3u8"}},
+		{"no known pathway", []string{"cdn-x"}, nil, "cdn-a", 2, []string{"video/iframes.m3u8"}},
+	}
+
+	for _, test := range tests {
+		manifest := &Manifest{Version: 1, TTL: 300, PathwayPriority: test.priority, PathwayClones: test.clones}
+		pathway, selected := manifest.PathwayVariants(playlist, baseURI, "cdn-a")
+		if pathway != test.want {
+			t.Errorf("%s: got pathway %s, want %s", test.name, pathway, test.want)
+		}
+		if len(selected.Playlists) != test.variants {
+			t.Errorf("%s: got %d variant streams, want %d", test.name, len(selected.Playlists), test.variants)
+		}
+		for _, variant := range selected.Playlists {
+			if PathwayID(variant) != test.want {
+				t.Errorf("%s: selected %s of pathway %s", test.name, variant.URI, PathwayID(variant))
+			}
+		}
+		if len(selected.IFramePlaylists) != len(test.iFrames) {
+			t.Errorf("%s: got %d i-frame playlists, want %d", test.name, len(selected.IFramePlaylists), len(test.iFrames))
+			continue
+		}
+		for i, uri := range test.iFrames {
+			if selected.IFramePlaylists[i].URI != uri {
+				t.Errorf("%s: got i-frame playlist %s, want %s", test.name, selected.IFramePlaylists[i].URI, uri)
+			}
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package validate
+
+import (
+	"math"
+	"strconv"
+)
+
+// rules checked against the low-latency HLS requirements of the second edition
+var (
+	ruleHoldBack              = rule{"llhls-hold-back", Error, "4.4.3.8", rfc8216bis}
+	rulePartHoldBackMissing   = rule{"llhls-part-hold-back-missing", Error, "4.4.3.8", rfc8216bis}
+	rulePartHoldBack          = rule{"llhls-part-hold-back", Error, "4.4.3.8", rfc8216bis}
+	rulePartHoldBackShort     = rule{"llhls-part-hold-back-short", Warning, "4.4.3.8", rfc8216bis}
+	ruleCanSkipUntil          = rule{"llhls-can-skip-until", Error, "4.4.3.8", rfc8216bis}
+	rulePartInfMissing        = rule{"llhls-part-inf-missing", Error, "4.4.3.7", rfc8216bis}
+	rulePartExceedsTarget     = rule{"llhls-part-exceeds-part-target", Error, "4.4.4.9", rfc8216bis}
+	rulePartTooShort          = rule{"llhls-part-too-short", Error, "4.4.4.9", rfc8216bis}
+	rulePartNotIndependent    = rule{"llhls-part-not-independent", Error, "4.4.2.1", rfc8216bis}
+	rulePartFirstIndependent  = rule{"llhls-first-part-not-independent", Warning, "4.4.4.9", rfc8216bis}
+	rulePreloadHintPlacement  = rule{"llhls-preload-hint-placement", Error, "4.4.5.3", rfc8216bis}
+	rulePreloadHintDuplicated = rule{"llhls-preload-hint-duplicated", Error, "4.4.5.3", rfc8216bis}
+	rulePreloadHintEndList    = rule{"llhls-preload-hint-endlist", Warning, "4.4.5.3", rfc8216bis}
+	ruleRenditionReport       = rule{"llhls-rendition-report-missing", Warning, "4.4.5.4", rfc8216bis}
+)
+
+// minimumPartDuration is the fraction of the part target duration that every
+// partial segment except the last one of a segment must last at least
+const minimumPartDuration = 0.85
+
+// findLine returns the first line of a tag type, or nil
+func (v *validation) findLine(tagType string) *line {
+	for _, l := range v.lines {
+		if l.tagType == tagType {
+			return l
+		}
+	}
+	return nil
+}
+
+// floatAttribute returns a decimal floating-point attribute of a line
+func floatAttribute(l *line, name string) (float64, bool) {
+	value, ok := l.attributes[name]
+	if !ok {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(value, 64)
+	return number, err == nil
+}
+
+// lessThan compares durations at millisecond precision, as the durations in
+// playlists are rounded decimals such as a part target of 0.33334 and a
+// PART-HOLD-BACK of 1.0
+func lessThan(a, b float64) bool {
+	return math.Round(a*1000) < math.Round(b*1000)
+}
+
+// partTarget returns the part target duration declared by #EXT-X-PART-INF,
+// or 0 if the playlist has none
+func (v *validation) partTarget() float64 {
+	if l := v.findLine("part-inf"); l != nil {
+		partTarget, _ := floatAttribute(l, "PART-TARGET")
+		return partTarget
+	}
+	return 0
+}
+
+// checkServerControl checks the hold back and skip durations of
+// #EXT-X-SERVER-CONTROL against the target durations
+func checkServerControl(v *validation) {
+	if v.multivariant {
+		return
+	}
+
+	l := v.findLine("server-control")
+	partInf := v.findLine("part-inf")
+	targetDuration := float64(v.manifest.TargetDuration)
+	partTarget := v.partTarget()
+
+	if l == nil {
+		if partInf != nil {
+			v.report(rulePartHoldBackMissing, partInf.number,
+				"playlist with #EXT-X-PART-INF lacks #EXT-X-SERVER-CONTROL with PART-HOLD-BACK")
+		}
+		return
+	}
+
+	if holdBack, ok := floatAttribute(l, "HOLD-BACK"); ok && targetDuration > 0 && lessThan(holdBack, 3*targetDuration) {
+		v.report(ruleHoldBack, l.number,
+			"HOLD-BACK %g is less than three times the target duration %g", holdBack, targetDuration)
+	}
+
+	if partHoldBack, ok := floatAttribute(l, "PART-HOLD-BACK"); ok {
+		switch {
+		case partTarget == 0:
+		case lessThan(partHoldBack, 2*partTarget):
+			v.report(rulePartHoldBack, l.number,
+				"PART-HOLD-BACK %g is less than twice the part target duration %g", partHoldBack, partTarget)
+		case lessThan(partHoldBack, 3*partTarget):
+			v.report(rulePartHoldBackShort, l.number,
+				"PART-HOLD-BACK %g is less than three times the part target duration %g", partHoldBack, partTarget)
+		}
+	} else if partInf != nil {
+		v.report(rulePartHoldBackMissing, l.number,
+			"#EXT-X-SERVER-CONTROL lacks PART-HOLD-BACK, which is required with #EXT-X-PART-INF")
+	}
+
+	if canSkipUntil, ok := floatAttribute(l, "CAN-SKIP-UNTIL"); ok && targetDuration > 0 && lessThan(canSkipUntil, 6*targetDuration) {
+		v.report(ruleCanSkipUntil, l.number,
+			"CAN-SKIP-UNTIL %g is less than six times the target duration %g", canSkipUntil, targetDuration)
+	}
+}
+
+// checkParts checks the durations of the partial segments and that segments
+// start with an independent partial segment
+func checkParts(v *validation) {
+	if v.multivariant {
+		return
+	}
+
+	partInf := v.findLine("part-inf")
+	partTarget := v.partTarget()
+	independentSegments := v.findLine("independent-segments") != nil
+	anyIndependent := false
+	for _, l := range v.lines {
+		if l.tagType == "part" && isYes(l.attributes["INDEPENDENT"]) {
+			anyIndependent = true
+			break
+		}
+	}
+
+	// checkSegment checks the partial segments of a segment, which may be
+	// incomplete if the segment is still being produced
+	checkSegment := func(parts []*line) {
+		for i, part := range parts {
+			duration, ok := floatAttribute(part, "DURATION")
+			if !ok || partTarget == 0 {
+				continue
+			}
+			if lessThan(partTarget, duration) {
+				v.report(rulePartExceedsTarget, part.number,
+					"partial segment duration %g exceeds the part target duration %g", duration, partTarget)
+			}
+			last := i == len(parts)-1
+			if !last && lessThan(duration, minimumPartDuration*partTarget) {
+				v.report(rulePartTooShort, part.number,
+					"partial segment duration %g is less than 85%% of the part target duration %g", duration, partTarget)
+			}
+		}
+
+		if len(parts) == 0 || isYes(parts[0].attributes["INDEPENDENT"]) {
+			return
+		}
+		switch {
+		case independentSegments:
+			v.report(rulePartNotIndependent, parts[0].number,
+				"first partial segment of a segment is not INDEPENDENT=YES although the playlist has #EXT-X-INDEPENDENT-SEGMENTS")
+		case anyIndependent:
+			v.report(rulePartFirstIndependent, parts[0].number,
+				"first partial segment of a segment is not INDEPENDENT=YES, so playback cannot start at the segment")
+		}
+	}
+
+	var parts []*line
+	first := true
+	for _, l := range v.lines {
+		switch l.tagType {
+		case "part":
+			if partInf == nil && first {
+				v.report(rulePartInfMissing, l.number, "playlist with #EXT-X-PART lacks #EXT-X-PART-INF")
+			}
+			first = false
+			parts = append(parts, l)
+		case "uri":
+			checkSegment(parts)
+			parts = nil
+		}
+	}
+	checkSegment(parts)
+}
+
+// checkPreloadHints checks that preload hints follow the last segment and
+// partial segment, and that each type of resource is hinted at most once
+func checkPreloadHints(v *validation) {
+	if v.multivariant {
+		return
+	}
+
+	hints := make(map[string]int)
+	var hint *line
+	for _, l := range v.lines {
+		switch l.tagType {
+		case "preload-hint":
+			if hint == nil {
+				hint = l
+			}
+			hintType := l.attributes["TYPE"]
+			if first, ok := hints[hintType]; ok {
+				v.report(rulePreloadHintDuplicated, l.number,
+					"#EXT-X-PRELOAD-HINT of TYPE=%s already occurred on line %d", hintType, first)
+			} else {
+				hints[hintType] = l.number
+			}
+
+		case "part", "inf", "uri":
+			if hint != nil {
+				v.report(rulePreloadHintPlacement, hint.number,
+					"#EXT-X-PRELOAD-HINT must follow the last segment and partial segment, but line %d follows it", l.number)
+				hint = nil
+			}
+		}
+	}
+
+	if first := v.findLine("preload-hint"); first != nil && v.findLine("endlist") != nil {
+		v.report(rulePreloadHintEndList, first.number, "#EXT-X-PRELOAD-HINT in a playlist with #EXT-X-ENDLIST")
+	}
+}
+
+// checkRenditionReports checks that a low-latency playlist reports the
+// latest segments of the other renditions
+func checkRenditionReports(v *validation) {
+	if v.multivariant || v.findLine("part-inf") == nil || v.findLine("endlist") != nil {
+		return
+	}
+	if v.findLine("rendition-report") == nil {
+		v.report(ruleRenditionReport, 0,
+			"low-latency playlist lacks #EXT-X-RENDITION-REPORT for the other renditions")
+	}
+}
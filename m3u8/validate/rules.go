@@ -0,0 +1,522 @@
+package validate
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+// rules checked against RFC 8216
+var (
+	ruleEXTM3U                = rule{"extm3u-first-line", Error, "4.3.1.1", rfc8216}
+	ruleTagDuplicated         = rule{"tag-duplicated", Error, "4.3.3", rfc8216}
+	ruleTagUnknown            = rule{"tag-unknown", Info, "6.3.1", rfc8216}
+	ruleAttributeMissing      = rule{"attribute-missing", Error, "4.2", rfc8216}
+	rulePlaylistTagsMixed     = rule{"playlist-tags-mixed", Error, "4.3.4", rfc8216}
+	ruleTargetDurationMissing = rule{"targetduration-missing", Error, "4.3.3.1", rfc8216}
+	ruleTagAfterFirstSegment  = rule{"tag-after-first-segment", Error, "4.3.3.2", rfc8216}
+	rulePlaylistTypeInvalid   = rule{"playlist-type-invalid", Error, "4.3.3.5", rfc8216}
+	ruleEXTINFMissing         = rule{"extinf-missing", Error, "4.3.2.1", rfc8216}
+	ruleEXTINFInvalid         = rule{"extinf-duration-invalid", Error, "4.3.2.1", rfc8216}
+	ruleEXTINFExceedsTarget   = rule{"extinf-exceeds-targetduration", Error, "4.3.3.1", rfc8216}
+	ruleByterangeOffset       = rule{"byterange-offset-missing", Error, "4.3.2.2", rfc8216}
+	ruleKeyMethodInvalid      = rule{"key-method-invalid", Error, "4.3.2.4", rfc8216}
+	ruleKeyNoneAttributes     = rule{"key-none-attributes", Error, "4.3.2.4", rfc8216}
+	ruleKeyIVInvalid          = rule{"key-iv-invalid", Error, "4.3.2.4", rfc8216}
+	ruleKeyFormatMissing      = rule{"key-keyformat-missing", Warning, "4.3.2.4", rfc8216}
+	ruleSessionKeyNone        = rule{"session-key-method-none", Error, "4.3.4.5", rfc8216}
+	ruleDateRangeNoPDT        = rule{"daterange-without-program-date-time", Error, "4.3.2.7", rfc8216}
+	ruleDateRangeDate         = rule{"daterange-date-invalid", Error, "4.3.2.7", rfc8216}
+	ruleDateRangeEnd          = rule{"daterange-end-before-start", Error, "4.3.2.7", rfc8216}
+	ruleDateRangeDuration     = rule{"daterange-duration-invalid", Error, "4.3.2.7", rfc8216}
+	ruleDateRangeEndOnNext    = rule{"daterange-end-on-next", Error, "4.3.2.7.1", rfc8216}
+	ruleMediaTypeInvalid      = rule{"media-type-invalid", Error, "4.3.4.1", rfc8216}
+	ruleMediaAttribute        = rule{"media-attribute-invalid", Error, "4.3.4.1", rfc8216}
+	ruleMediaAutoselect       = rule{"media-autoselect-not-yes", Error, "4.3.4.1", rfc8216}
+	ruleMediaNameDuplicated   = rule{"media-name-duplicated", Error, "4.3.4.1.1", rfc8216}
+	ruleMediaDefaultDuplicate = rule{"media-default-duplicated", Error, "4.3.4.1.1", rfc8216}
+	ruleStreamInfURIMissing   = rule{"stream-inf-uri-missing", Error, "4.3.4.2", rfc8216}
+	ruleMediaGroupUndefined   = rule{"media-group-undefined", Error, "4.3.4.2", rfc8216}
+	ruleClosedCaptionsNone    = rule{"closed-captions-none-mixed", Error, "4.3.4.2", rfc8216}
+)
+
+// singleTags are the tags that must not occur more than once, by the section
+// that requires it
+var singleTags = map[string]string{
+	"version":                "4.3.1.2",
+	"targetduration":         "4.3.3",
+	"media-sequence":         "4.3.3",
+	"discontinuity-sequence": "4.3.3",
+	"endlist":                "4.3.3",
+	"playlist-type":          "4.3.3",
+	"i-frames-only":          "4.3.3",
+	"independent-segments":   "4.3.5",
+	"start":                  "4.3.5",
+}
+
+// mediaTags are the media segment and media playlist tags, which must not
+// occur in a multivariant playlist, by the section that defines them
+var mediaTags = map[string]string{
+	"inf":                    "4.3.2",
+	"byterange":              "4.3.2",
+	"discontinuity":          "4.3.2",
+	"key":                    "4.3.2",
+	"map":                    "4.3.2",
+	"program-date-time":      "4.3.2",
+	"daterange":              "4.3.2",
+	"gap":                    "4.3.2",
+	"bitrate":                "4.3.2",
+	"part":                   "4.3.2",
+	"targetduration":         "4.3.3",
+	"media-sequence":         "4.3.3",
+	"discontinuity-sequence": "4.3.3",
+	"endlist":                "4.3.3",
+	"playlist-type":          "4.3.3",
+	"i-frames-only":          "4.3.3",
+	"part-inf":               "4.3.3",
+	"server-control":         "4.3.3",
+	"skip":                   "4.3.3",
+	"preload-hint":           "4.3.3",
+	"rendition-report":       "4.3.3",
+}
+
+// multivariantTags are the tags that only occur in multivariant playlists
+var multivariantTags = map[string]bool{
+	"media":            true,
+	"stream-inf":       true,
+	"i-frame-playlist": true,
+	"session-data":     true,
+	"session-key":      true,
+	"content-steering": true,
+}
+
+// requiredAttributes are the attributes every occurrence of a tag must have,
+// by tag type
+var requiredAttributes = map[string]struct {
+	section string
+	names   []string
+}{
+	"key":              {"4.3.2.4", []string{"METHOD"}},
+	"daterange":        {"4.3.2.7", []string{"ID", "START-DATE"}},
+	"media":            {"4.3.4.1", []string{"TYPE", "GROUP-ID", "NAME"}},
+	"stream-inf":       {"4.3.4.2", []string{"BANDWIDTH"}},
+	"i-frame-playlist": {"4.3.4.3", []string{"BANDWIDTH", "URI"}},
+	"session-data":     {"4.3.4.4", []string{"DATA-ID"}},
+	"session-key":      {"4.3.4.5", []string{"METHOD", "URI"}},
+	"start":            {"4.3.5.2", []string{"TIME-OFFSET"}},
+}
+
+// instreamIDPattern matches the valid INSTREAM-ID values
+var instreamIDPattern = regexp.MustCompile(`^(CC[1-4]|SERVICE([1-9]|[1-5][0-9]|6[0-3]))$`)
+
+// ivPattern matches a 128-bit hexadecimal-sequence
+var ivPattern = regexp.MustCompile(`^0[xX][0-9A-Fa-f]{32}$`)
+
+// withSection returns the rule with a different section of the specification
+func (r rule) withSection(section string) rule {
+	r.section = section
+	return r
+}
+
+// checkHeader checks that the playlist starts with #EXTM3U
+func checkHeader(v *validation) {
+	if len(v.lines) == 0 {
+		v.report(ruleEXTM3U, 0, "playlist is empty")
+		return
+	}
+	if v.lines[0].text != "#EXTM3U" {
+		v.report(ruleEXTM3U, 1, "first line is %q instead of #EXTM3U", v.lines[0].text)
+	}
+}
+
+// checkTags checks the tags that occur at most once, unknown tags and the
+// required attributes of every tag
+func checkTags(v *validation) {
+	seen := make(map[string]int)
+	for _, l := range v.lines {
+		if l.event != nil && l.event["type"] == "tag" && l.tagType == "" {
+			v.report(ruleTagUnknown, l.number, "unknown tag %s is ignored", l.name())
+			continue
+		}
+
+		if section, ok := singleTags[l.tagType]; ok {
+			if first, ok := seen[l.tagType]; ok {
+				v.report(ruleTagDuplicated.withSection(section), l.number,
+					"%s already occurred on line %d", l.name(), first)
+			} else {
+				seen[l.tagType] = l.number
+			}
+		}
+
+		// parsestream only reports the URI and BYTERANGE of #EXT-X-MAP
+		if _, ok := l.event["uri"]; l.tagType == "map" && !ok {
+			v.report(ruleAttributeMissing.withSection("4.3.2.5"), l.number, "%s lacks required attribute URI", l.name())
+		}
+
+		if required, ok := requiredAttributes[l.tagType]; ok {
+			for _, name := range required.names {
+				if _, ok := l.attributes[name]; !ok {
+					v.report(ruleAttributeMissing.withSection(required.section), l.number,
+						"%s lacks required attribute %s", l.name(), name)
+				}
+			}
+		}
+	}
+}
+
+// isMultivariant reports whether lines form a multivariant playlist, which is
+// decided by the first tag that only occurs in one kind of playlist
+func isMultivariant(lines []*line) bool {
+	for _, l := range lines {
+		if multivariantTags[l.tagType] {
+			return true
+		}
+		if _, ok := mediaTags[l.tagType]; ok {
+			return false
+		}
+	}
+	return false
+}
+
+// checkPlaylistKind checks that a playlist does not mix the tags of media and
+// multivariant playlists
+func checkPlaylistKind(v *validation) {
+	for _, l := range v.lines {
+		if section, ok := mediaTags[l.tagType]; ok && v.multivariant {
+			v.report(rulePlaylistTagsMixed.withSection(section), l.number,
+				"media playlist tag %s in a multivariant playlist", l.name())
+		}
+		if multivariantTags[l.tagType] && !v.multivariant {
+			v.report(rulePlaylistTagsMixed, l.number,
+				"multivariant playlist tag %s in a media playlist", l.name())
+		}
+	}
+}
+
+// checkMediaPlaylist checks the media playlist tags
+func checkMediaPlaylist(v *validation) {
+	if v.multivariant {
+		return
+	}
+
+	targetDuration := false
+	segments := false
+	discontinuity := false
+	for _, l := range v.lines {
+		switch l.tagType {
+		case "targetduration":
+			targetDuration = true
+		case "uri":
+			segments = true
+		case "discontinuity":
+			discontinuity = true
+		case "media-sequence":
+			if segments {
+				v.report(ruleTagAfterFirstSegment, l.number,
+					"%s must occur before the first media segment", l.name())
+			}
+		case "discontinuity-sequence":
+			if segments || discontinuity {
+				v.report(ruleTagAfterFirstSegment.withSection("4.3.3.3"), l.number,
+					"%s must occur before the first media segment and discontinuity", l.name())
+			}
+		case "playlist-type":
+			if playlistType, _ := l.event["playlistType"].(string); playlistType != "EVENT" && playlistType != "VOD" {
+				v.report(rulePlaylistTypeInvalid, l.number, "playlist type %q is neither EVENT nor VOD", playlistType)
+			}
+		}
+	}
+
+	if !targetDuration && (segments || len(v.lines) > 1) {
+		v.report(ruleTargetDurationMissing, 0, "media playlist lacks #EXT-X-TARGETDURATION")
+	}
+}
+
+// checkSegments checks the durations and byte ranges of the media segments
+func checkSegments(v *validation) {
+	if v.multivariant {
+		return
+	}
+
+	var inf, byterange *line
+	previousURI := ""
+	previousByterange := false
+	for _, l := range v.lines {
+		switch l.tagType {
+		case "inf":
+			inf = l
+			duration, ok := l.event["duration"].(float64)
+			if !ok || duration < 0 || math.IsInf(duration, 0) {
+				v.report(ruleEXTINFInvalid, l.number, "#EXTINF lacks a valid duration")
+				continue
+			}
+			if target := v.manifest.TargetDuration; target > 0 && int(math.Round(duration)) > target {
+				v.report(ruleEXTINFExceedsTarget, l.number,
+					"segment duration %g exceeds the target duration %d when rounded", duration, target)
+			}
+
+		case "byterange":
+			byterange = l
+
+		case "uri":
+			if inf == nil {
+				v.report(ruleEXTINFMissing, l.number, "media segment %s lacks #EXTINF", l.text)
+			}
+			if byterange != nil && !strings.Contains(byterange.text, "@") &&
+				(!previousByterange || previousURI != l.text) {
+				v.report(ruleByterangeOffset, byterange.number,
+					"#EXT-X-BYTERANGE without offset must follow a sub-range of the same resource %s", l.text)
+			}
+			previousURI = l.text
+			previousByterange = byterange != nil
+			inf, byterange = nil, nil
+		}
+	}
+}
+
+// checkKeys checks the attributes of #EXT-X-KEY and #EXT-X-SESSION-KEY
+func checkKeys(v *validation) {
+	for _, l := range v.lines {
+		if l.tagType != "key" && l.tagType != "session-key" {
+			continue
+		}
+		method, ok := l.attributes["METHOD"]
+		if !ok {
+			continue
+		}
+
+		section := "4.3.2.4"
+		if l.tagType == "session-key" {
+			section = "4.3.4.5"
+		}
+
+		switch {
+		case !parser.EncryptionMethod(method).IsValid():
+			v.report(ruleKeyMethodInvalid.withSection(section), l.number, "%s has unknown METHOD %s", l.name(), method)
+		case method == string(parser.MethodNone) && l.tagType == "session-key":
+			v.report(ruleSessionKeyNone, l.number, "%s must not have METHOD=NONE", l.name())
+		case method == string(parser.MethodNone):
+			if len(l.attributes) > 1 {
+				v.report(ruleKeyNoneAttributes, l.number, "%s with METHOD=NONE must not have other attributes", l.name())
+			}
+		case l.tagType == "key":
+			if _, ok := l.attributes["URI"]; !ok {
+				v.report(ruleAttributeMissing.withSection(section), l.number,
+					"%s with METHOD=%s lacks required attribute URI", l.name(), method)
+			}
+		}
+
+		if _, ok := l.attributes["KEYFORMAT"]; !ok && parser.EncryptionMethod(method).IsSampleEncryption() {
+			v.report(ruleKeyFormatMissing.withSection(section), l.number,
+				"%s with METHOD=%s lacks KEYFORMAT and defaults to the identity key format", l.name(), method)
+		}
+
+		if iv, ok := l.attributes["IV"]; ok && !ivPattern.MatchString(iv) {
+			v.report(ruleKeyIVInvalid.withSection(section), l.number, "%s IV is not a 128-bit hexadecimal integer", l.name())
+		}
+	}
+}
+
+// checkDateRanges checks the dates and durations of #EXT-X-DATERANGE
+func checkDateRanges(v *validation) {
+	programDateTime := false
+	var first *line
+	for _, l := range v.lines {
+		switch l.tagType {
+		case "program-date-time":
+			programDateTime = true
+		case "daterange":
+			if first == nil {
+				first = l
+			}
+			checkDateRange(v, l)
+		}
+	}
+
+	if first != nil && !programDateTime {
+		v.report(ruleDateRangeNoPDT, first.number, "playlist with #EXT-X-DATERANGE lacks #EXT-X-PROGRAM-DATE-TIME")
+	}
+}
+
+// checkDateRange checks a single #EXT-X-DATERANGE
+func checkDateRange(v *validation, l *line) {
+	dates := make(map[string]time.Time)
+	for _, name := range []string{"START-DATE", "END-DATE"} {
+		value, ok := l.attributes[name]
+		if !ok {
+			continue
+		}
+		date, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			v.report(ruleDateRangeDate, l.number, "#EXT-X-DATERANGE %s %q is not an ISO 8601 date", name, value)
+			continue
+		}
+		dates[name] = date
+	}
+
+	start, hasStart := dates["START-DATE"]
+	end, hasEnd := dates["END-DATE"]
+	if hasStart && hasEnd && end.Before(start) {
+		v.report(ruleDateRangeEnd, l.number, "#EXT-X-DATERANGE END-DATE is before START-DATE")
+	}
+
+	for _, name := range []string{"DURATION", "PLANNED-DURATION"} {
+		value, ok := l.attributes[name]
+		if !ok {
+			continue
+		}
+		duration, err := strconv.ParseFloat(value, 64)
+		if err != nil || duration < 0 {
+			v.report(ruleDateRangeDuration, l.number, "#EXT-X-DATERANGE %s %q is not a non-negative number", name, value)
+			continue
+		}
+		if name == "DURATION" && hasStart && hasEnd &&
+			!start.Add(time.Duration(duration*float64(time.Second))).Equal(end) {
+			v.report(ruleDateRangeDuration, l.number, "#EXT-X-DATERANGE END-DATE does not equal START-DATE plus DURATION")
+		}
+	}
+
+	if value, ok := l.attributes["END-ON-NEXT"]; ok {
+		_, hasClass := l.attributes["CLASS"]
+		_, hasDuration := l.attributes["DURATION"]
+		_, hasEndDate := l.attributes["END-DATE"]
+		switch {
+		case !isYes(value):
+			v.report(ruleDateRangeEndOnNext, l.number, "#EXT-X-DATERANGE END-ON-NEXT must be YES")
+		case !hasClass:
+			v.report(ruleDateRangeEndOnNext, l.number, "#EXT-X-DATERANGE with END-ON-NEXT lacks CLASS")
+		case hasDuration || hasEndDate:
+			v.report(ruleDateRangeEndOnNext, l.number, "#EXT-X-DATERANGE with END-ON-NEXT must not have DURATION or END-DATE")
+		}
+	}
+}
+
+// checkRenditions checks the #EXT-X-MEDIA renditions and their groups
+func checkRenditions(v *validation) {
+	names := make(map[string]int)
+	defaults := make(map[string]int)
+
+	for _, l := range v.lines {
+		if l.tagType != "media" {
+			continue
+		}
+		mediaType := l.attributes["TYPE"]
+		groupID, hasGroup := l.attributes["GROUP-ID"]
+		name := l.attributes["NAME"]
+		_, hasURI := l.attributes["URI"]
+		instreamID, hasInstreamID := l.attributes["INSTREAM-ID"]
+
+		switch mediaType {
+		case "AUDIO", "VIDEO", "SUBTITLES", "CLOSED-CAPTIONS":
+		case "":
+			continue
+		default:
+			v.report(ruleMediaTypeInvalid, l.number, "#EXT-X-MEDIA has unknown TYPE %s", mediaType)
+			continue
+		}
+
+		switch {
+		case mediaType == "CLOSED-CAPTIONS" && hasURI:
+			v.report(ruleMediaAttribute, l.number, "#EXT-X-MEDIA of TYPE=CLOSED-CAPTIONS must not have a URI")
+		case mediaType == "CLOSED-CAPTIONS" && !hasInstreamID:
+			v.report(ruleAttributeMissing.withSection("4.3.4.1"), l.number,
+				"#EXT-X-MEDIA of TYPE=CLOSED-CAPTIONS lacks required attribute INSTREAM-ID")
+		case mediaType == "CLOSED-CAPTIONS" && !instreamIDPattern.MatchString(instreamID):
+			v.report(ruleMediaAttribute, l.number, "#EXT-X-MEDIA has invalid INSTREAM-ID %q", instreamID)
+		case mediaType != "CLOSED-CAPTIONS" && hasInstreamID:
+			v.report(ruleMediaAttribute, l.number, "#EXT-X-MEDIA of TYPE=%s must not have an INSTREAM-ID", mediaType)
+		case mediaType == "SUBTITLES" && !hasURI:
+			v.report(ruleAttributeMissing.withSection("4.3.4.1"), l.number,
+				"#EXT-X-MEDIA of TYPE=SUBTITLES lacks required attribute URI")
+		}
+		if _, ok := l.attributes["FORCED"]; ok && mediaType != "SUBTITLES" {
+			v.report(ruleMediaAttribute, l.number, "#EXT-X-MEDIA of TYPE=%s must not have FORCED", mediaType)
+		}
+
+		isDefault := isYes(l.attributes["DEFAULT"])
+		if autoselect, ok := l.attributes["AUTOSELECT"]; ok && isDefault && !isYes(autoselect) {
+			v.report(ruleMediaAutoselect, l.number, "#EXT-X-MEDIA with DEFAULT=YES must have AUTOSELECT=YES")
+		}
+
+		if !hasGroup {
+			continue
+		}
+		group := mediaType + " " + groupID
+		if first, ok := names[group+" "+name]; ok {
+			v.report(ruleMediaNameDuplicated, l.number,
+				"%s group %q already has a rendition named %q on line %d", mediaType, groupID, name, first)
+		} else {
+			names[group+" "+name] = l.number
+		}
+		if isDefault {
+			if first, ok := defaults[group]; ok {
+				v.report(ruleMediaDefaultDuplicate, l.number,
+					"%s group %q already has a default rendition on line %d", mediaType, groupID, first)
+			} else {
+				defaults[group] = l.number
+			}
+		}
+	}
+}
+
+// checkVariants checks the variant streams and i-frame playlists
+func checkVariants(v *validation) {
+	groups := make(map[string]bool)
+	for _, l := range v.lines {
+		if l.tagType == "media" {
+			groups[l.attributes["TYPE"]+" "+l.attributes["GROUP-ID"]] = true
+		}
+	}
+
+	closedCaptionsNone := []int{}
+	variants := 0
+	for i, l := range v.lines {
+		if l.tagType != "stream-inf" && l.tagType != "i-frame-playlist" {
+			continue
+		}
+
+		mediaTypes := []string{"VIDEO"}
+		if l.tagType == "stream-inf" {
+			variants++
+			mediaTypes = []string{"AUDIO", "VIDEO", "SUBTITLES", "CLOSED-CAPTIONS"}
+			if !followedByURI(v.lines[i+1:]) {
+				v.report(ruleStreamInfURIMissing, l.number, "#EXT-X-STREAM-INF is not followed by a URI line")
+			}
+			if l.attributes["CLOSED-CAPTIONS"] == "NONE" {
+				closedCaptionsNone = append(closedCaptionsNone, l.number)
+			}
+		}
+
+		for _, mediaType := range mediaTypes {
+			groupID, ok := l.attributes[mediaType]
+			if !ok || (mediaType == "CLOSED-CAPTIONS" && groupID == "NONE") {
+				continue
+			}
+			if !groups[mediaType+" "+groupID] {
+				v.report(ruleMediaGroupUndefined.withSection(requiredAttributes[l.tagType].section), l.number,
+					"%s=%q does not match the GROUP-ID of any #EXT-X-MEDIA of TYPE=%s", mediaType, groupID, mediaType)
+			}
+		}
+	}
+
+	if len(closedCaptionsNone) > 0 && len(closedCaptionsNone) < variants {
+		v.report(ruleClosedCaptionsNone, closedCaptionsNone[0],
+			"CLOSED-CAPTIONS=NONE must be set on all variant streams if it is set on one")
+	}
+}
+
+// followedByURI reports whether the next line that is not blank or a comment
+// is a URI line
+func followedByURI(lines []*line) bool {
+	for _, l := range lines {
+		if l.tagType == "comment" || l.text == "" {
+			continue
+		}
+		return l.tagType == "uri"
+	}
+	return false
+}
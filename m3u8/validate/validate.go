@@ -0,0 +1,247 @@
+// Package validate checks playlists against the requirements of RFC 8216 and
+// its second edition, and reports every violation as a finding with a rule
+// identifier, severity, line number and section of the specification
+package validate
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parsestream"
+)
+
+// Severity is the severity of a finding
+type Severity string
+
+const (
+	// Error is a violation of a MUST or MUST NOT requirement
+	Error Severity = "error"
+	// Warning is a violation of a SHOULD or SHOULD NOT requirement
+	Warning Severity = "warning"
+	// Info is a remark that does not violate the specification
+	Info Severity = "info"
+)
+
+// specifications that state the checked requirements
+const (
+	rfc8216    = "RFC 8216"
+	rfc8216bis = "draft-pantos-hls-rfc8216bis"
+)
+
+// Finding is a violation found in a playlist
+type Finding struct {
+	// Rule identifies the checked requirement, e.g. "extinf-exceeds-targetduration"
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	// Line is the 1-based line number of the violation, or 0 if it concerns
+	// the playlist as a whole
+	Line int `json:"line,omitempty"`
+	// Specification is the document that states the requirement, RFC 8216 or
+	// draft-pantos-hls-rfc8216bis for the features added by the second edition
+	Specification string `json:"specification"`
+	// Section is the section of the specification that states the requirement
+	Section string `json:"section"`
+	Message string `json:"message"`
+}
+
+// String formats the finding for humans
+func (f Finding) String() string {
+	location := "playlist"
+	if f.Line > 0 {
+		location = fmt.Sprintf("line %d", f.Line)
+	}
+	return fmt.Sprintf("%s: %s: %s [%s, %s section %s]",
+		location, f.Severity, f.Message, f.Rule, f.Specification, f.Section)
+}
+
+// HasErrors reports whether any of the findings is an error
+func HasErrors(findings []Finding) bool {
+	for _, finding := range findings {
+		if finding.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
+
+// rule is a requirement of the specification
+type rule struct {
+	id            string
+	severity      Severity
+	section       string
+	specification string
+}
+
+// line is a line of the playlist with the event parsestream emitted for it
+type line struct {
+	number int
+	text   string
+	// tagType is the tag type reported by parsestream, or the one of the tag
+	// name if parsestream could not parse the tag, "uri" for URI lines,
+	// "comment" for comments and empty for blank lines and unknown tags
+	tagType    string
+	event      map[string]interface{}
+	attributes map[string]string
+}
+
+// name returns the tag name of the line, e.g. #EXT-X-KEY
+func (l *line) name() string {
+	if i := strings.Index(l.text, ":"); i >= 0 {
+		return l.text[:i]
+	}
+	return l.text
+}
+
+// validation holds the state of a validation run
+type validation struct {
+	manifest *parser.Manifest
+	lines    []*line
+	// multivariant is set if the lines form a multivariant playlist
+	multivariant bool
+	findings     []Finding
+}
+
+// report adds a finding for a rule at a line, or for the whole playlist if
+// the line is 0
+func (v *validation) report(r rule, number int, format string, args ...interface{}) {
+	v.findings = append(v.findings, Finding{
+		Rule:          r.id,
+		Severity:      r.severity,
+		Line:          number,
+		Specification: r.specification,
+		Section:       r.section,
+		Message:       fmt.Sprintf(format, args...),
+	})
+}
+
+// checks are the checks run by Validate, in order
+var checks = []func(v *validation){
+	checkHeader,
+	checkTags,
+	checkPlaylistKind,
+	checkMediaPlaylist,
+	checkSegments,
+	checkKeys,
+	checkDateRanges,
+	checkRenditions,
+	checkVariants,
+	checkVersion,
+	checkServerControl,
+	checkParts,
+	checkPreloadHints,
+	checkRenditionReports,
+}
+
+// Validate checks a manifest and the playlist text it was parsed from. The
+// findings are ordered by line number; findings about the whole playlist come
+// first.
+func Validate(manifest *parser.Manifest, input string) []Finding {
+	v := &validation{
+		manifest: manifest,
+		lines:    splitLines(input),
+	}
+	v.multivariant = isMultivariant(v.lines)
+	for _, check := range checks {
+		check(v)
+	}
+
+	sort.SliceStable(v.findings, func(i, j int) bool {
+		return v.findings[i].Line < v.findings[j].Line
+	})
+	return v.findings
+}
+
+// ValidateString parses a playlist and checks it
+func ValidateString(input string) []Finding {
+	p := parser.NewParser(nil)
+	p.Push(input)
+	p.End()
+	return Validate(p.Manifest, input)
+}
+
+// tagTypes are the tag types of the tags parsestream knows, by tag name. They
+// classify the lines parsestream could not parse, so that a malformed tag is
+// reported by the rules for that tag rather than as an unknown tag.
+var tagTypes = map[string]string{
+	"#EXTM3U":                       "m3u",
+	"#EXTINF":                       "inf",
+	"#EXT-X-TARGETDURATION":         "targetduration",
+	"#EXT-X-VERSION":                "version",
+	"#EXT-X-MEDIA-SEQUENCE":         "media-sequence",
+	"#EXT-X-DISCONTINUITY-SEQUENCE": "discontinuity-sequence",
+	"#EXT-X-PLAYLIST-TYPE":          "playlist-type",
+	"#EXT-X-BYTERANGE":              "byterange",
+	"#EXT-X-ALLOW-CACHE":            "allow-cache",
+	"#EXT-X-MAP":                    "map",
+	"#EXT-X-STREAM-INF":             "stream-inf",
+	"#EXT-X-MEDIA":                  "media",
+	"#EXT-X-ENDLIST":                "endlist",
+	"#EXT-X-DISCONTINUITY":          "discontinuity",
+	"#EXT-X-GAP":                    "gap",
+	"#EXT-X-BITRATE":                "bitrate",
+	"#EXT-X-PROGRAM-DATE-TIME":      "program-date-time",
+	"#EXT-X-KEY":                    "key",
+	"#EXT-X-SESSION-KEY":            "session-key",
+	"#EXT-X-SESSION-DATA":           "session-data",
+	"#EXT-X-START":                  "start",
+	"#EXT-X-SKIP":                   "skip",
+	"#EXT-X-PART":                   "part",
+	"#EXT-X-PRELOAD-HINT":           "preload-hint",
+	"#EXT-X-RENDITION-REPORT":       "rendition-report",
+	"#EXT-X-SERVER-CONTROL":         "server-control",
+	"#EXT-X-PART-INF":               "part-inf",
+	"#EXT-X-DATERANGE":              "daterange",
+	"#EXT-X-CONTENT-STEERING":       "content-steering",
+	"#EXT-X-DEFINE":                 "define",
+	"#EXT-X-INDEPENDENT-SEGMENTS":   "independent-segments",
+	"#EXT-X-I-FRAMES-ONLY":          "i-frames-only",
+	"#EXT-X-I-FRAME-STREAM-INF":     "i-frame-playlist",
+}
+
+// splitLines splits a playlist into lines and classifies them with parsestream
+func splitLines(input string) []*line {
+	var event map[string]interface{}
+	ps := parsestream.NewParseStream()
+	ps.On("data", func(data interface{}) {
+		event, _ = data.(map[string]interface{})
+	})
+
+	texts := strings.Split(input, "\n")
+	if len(texts) > 0 && texts[len(texts)-1] == "" {
+		texts = texts[:len(texts)-1]
+	}
+
+	lines := make([]*line, 0, len(texts))
+	for i, text := range texts {
+		event = nil
+		ps.Push(text)
+
+		l := &line{
+			number: i + 1,
+			text:   strings.TrimSpace(text),
+			event:  event,
+		}
+		if event != nil {
+			switch event["type"] {
+			case "uri", "comment":
+				l.tagType = event["type"].(string)
+			case "tag":
+				l.tagType, _ = event["tagType"].(string)
+				if l.tagType == "" {
+					l.tagType = tagTypes[l.name()]
+				}
+			}
+			l.attributes, _ = event["attributes"].(map[string]string)
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+// isYes reports whether an enumerated attribute is YES, which parsestream
+// reports as "true" for some tags
+func isYes(value string) bool {
+	return value == "YES" || value == "true"
+}
@@ -0,0 +1,446 @@
+package validate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// finding returns the first finding of a rule, or nil
+func finding(findings []Finding, rule string) *Finding {
+	for i := range findings {
+		if findings[i].Rule == rule {
+			return &findings[i]
+		}
+	}
+	return nil
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		rule     string
+		playlist string
+		line     int
+		severity Severity
+	}{
+		{"extm3u-first-line", "", 0, Error},
+		{"extm3u-first-line", `#EXT-X-TARGETDURATION:10
+#EXTM3U
+`, 1, Error},
+		{"tag-duplicated", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-TARGETDURATION:10
+#EXTINF:10,
+segment.ts
+`, 3, Error},
+		{"tag-unknown", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-VENDOR-TAG:1
+#EXTINF:10,
+segment.ts
+`, 3, Info},
+		{"attribute-missing", `#EXTM3U
+#EXT-X-STREAM-INF:RESOLUTION=640x360
+low.m3u8
+`, 2, Error},
+		{"attribute-missing", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-KEY:METHOD=AES-128
+#EXTINF:10,
+segment.ts
+`, 3, Error},
+		{"playlist-tags-mixed", `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=1280000
+low.m3u8
+#EXT-X-TARGETDURATION:10
+`, 4, Error},
+		{"targetduration-missing", `#EXTM3U
+#EXTINF:10,
+segment.ts
+`, 0, Error},
+		{"tag-after-first-segment", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10,
+segment.ts
+#EXT-X-MEDIA-SEQUENCE:1
+`, 5, Error},
+		{"tag-after-first-segment", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-DISCONTINUITY
+#EXT-X-DISCONTINUITY-SEQUENCE:1
+#EXTINF:10,
+segment.ts
+`, 4, Error},
+		{"playlist-type-invalid", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-PLAYLIST-TYPE:LIVE
+#EXTINF:10,
+segment.ts
+`, 3, Error},
+		{"extinf-missing", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+segment.ts
+`, 3, Error},
+		{"extinf-duration-invalid", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:abc,
+segment.ts
+`, 3, Error},
+		{"extinf-exceeds-targetduration", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10.6,
+segment.ts
+`, 3, Error},
+		{"byterange-offset-missing", `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-TARGETDURATION:10
+#EXT-X-BYTERANGE:1000
+#EXTINF:10,
+segment.ts
+`, 4, Error},
+		{"key-method-invalid", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-KEY:METHOD=ROT13,URI="key.bin"
+#EXTINF:10,
+segment.ts
+`, 3, Error},
+		{"key-none-attributes", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-KEY:METHOD=NONE,URI="key.bin"
+#EXTINF:10,
+segment.ts
+`, 3, Error},
+		{"key-iv-invalid", `#EXTM3U
+#EXT-X-VERSION:2
+#EXT-X-TARGETDURATION:10
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin",IV=0x1234
+#EXTINF:10,
+segment.ts
+`, 4, Error},
+		{"key-keyformat-missing", `#EXTM3U
+#EXT-X-VERSION:5
+#EXT-X-TARGETDURATION:10
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="key.bin"
+#EXTINF:10,
+segment.ts
+#EXT-X-ENDLIST
+`, 4, Warning},
+		{"key-keyformat-missing", `#EXTM3U
+#EXT-X-SESSION-KEY:METHOD=SAMPLE-AES-CTR,URI="key.bin"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000
+low.m3u8
+`, 2, Warning},
+		{"session-key-method-none", `#EXTM3U
+#EXT-X-SESSION-KEY:METHOD=NONE,URI="key.bin"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000
+low.m3u8
+`, 2, Error},
+		{"daterange-without-program-date-time", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-DATERANGE:ID="ad",START-DATE="2020-01-01T00:00:00Z"
+#EXTINF:10,
+segment.ts
+`, 3, Error},
+		{"daterange-date-invalid", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T00:00:00Z
+#EXT-X-DATERANGE:ID="ad",START-DATE="yesterday"
+#EXTINF:10,
+segment.ts
+`, 4, Error},
+		{"daterange-end-before-start", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T00:00:00Z
+#EXT-X-DATERANGE:ID="ad",START-DATE="2020-01-01T00:00:10Z",END-DATE="2020-01-01T00:00:00Z"
+#EXTINF:10,
+segment.ts
+`, 4, Error},
+		{"daterange-duration-invalid", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T00:00:00Z
+#EXT-X-DATERANGE:ID="ad",START-DATE="2020-01-01T00:00:00Z",DURATION=-1
+#EXTINF:10,
+segment.ts
+`, 4, Error},
+		{"daterange-end-on-next", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T00:00:00Z
+#EXT-X-DATERANGE:ID="ad",START-DATE="2020-01-01T00:00:00Z",END-ON-NEXT=YES
+#EXTINF:10,
+segment.ts
+`, 4, Error},
+		{"media-type-invalid", `#EXTM3U
+#EXT-X-MEDIA:TYPE=DATA,GROUP-ID="data",NAME="Data"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000
+low.m3u8
+`, 2, Error},
+		{"media-attribute-invalid", `#EXTM3U
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="English",INSTREAM-ID="CC1",URI="cc.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,CLOSED-CAPTIONS="cc"
+low.m3u8
+`, 2, Error},
+		{"media-autoselect-not-yes", `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,AUTOSELECT=NO,URI="en.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO="aac"
+low.m3u8
+`, 2, Error},
+		{"media-name-duplicated", `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",URI="en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",URI="en2.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO="aac"
+low.m3u8
+`, 3, Error},
+		{"media-default-duplicated", `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",DEFAULT=YES,AUTOSELECT=YES,URI="en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="German",DEFAULT=YES,AUTOSELECT=YES,URI="de.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO="aac"
+low.m3u8
+`, 3, Error},
+		{"stream-inf-uri-missing", `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=1280000
+#EXT-X-STREAM-INF:BANDWIDTH=2560000
+high.m3u8
+`, 2, Error},
+		{"media-group-undefined", `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,AUDIO="aac"
+low.m3u8
+`, 2, Error},
+		{"closed-captions-none-mixed", `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=1280000
+low.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,CLOSED-CAPTIONS=NONE
+high.m3u8
+`, 4, Error},
+
+		// protocol version compatibility
+		{"version-too-low", `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:10
+#EXTINF:10,
+segment1.ts
+#EXT-X-BYTERANGE:1000@0
+#EXTINF:10,
+segment2.ts
+`, 6, Error},
+		{"version-too-low", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10,
+segment1.ts
+#EXTINF:9.5,
+segment2.ts
+`, 5, Error},
+		{"version-too-low", `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:10,
+segment1.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin",IV=0x00000000000000000000000000000001
+#EXTINF:10,
+segment2.ts
+`, 5, Error},
+		{"version-too-low", `#EXTM3U
+#EXT-X-VERSION:4
+#EXT-X-TARGETDURATION:10
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin"
+#EXTINF:10,
+segment1.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin",KEYFORMAT="com.example"
+#EXTINF:10,
+segment2.ts
+`, 7, Error},
+		{"version-too-low", `#EXTM3U
+#EXT-X-VERSION:5
+#EXT-X-TARGETDURATION:10
+#EXTINF:10,
+segment1.ts
+#EXT-X-MAP:URI="init.mp4"
+#EXTINF:10,
+segment2.mp4
+`, 6, Error},
+		{"version-too-low", `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="English",INSTREAM-ID="CC1"
+#EXT-X-MEDIA:TYPE=CLOSED-CAPTIONS,GROUP-ID="cc",NAME="Spanish",INSTREAM-ID="SERVICE2"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000,CLOSED-CAPTIONS="cc"
+low.m3u8
+`, 4, Error},
+		{"version-too-low", `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-DEFINE:NAME="host",VALUE="example.com"
+#EXT-X-STREAM-INF:BANDWIDTH=1280000
+https://{$host}/low.m3u8
+`, 3, Error},
+		{"version-too-low", `#EXTM3U
+#EXT-X-VERSION:11
+#EXT-X-STREAM-INF:BANDWIDTH=1280000
+low.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=2560000,REQ-VIDEO-LAYOUT="CH-STEREO"
+high.m3u8
+`, 5, Error},
+		{"allow-cache-removed", `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-TARGETDURATION:10
+#EXT-X-ALLOW-CACHE:YES
+#EXTINF:10,
+segment.ts
+`, 4, Warning},
+
+		// low-latency HLS
+		{"llhls-hold-back", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:HOLD-BACK=6.0
+#EXTINF:4,
+segment.ts
+`, 3, Error},
+		{"llhls-can-skip-until", `#EXTM3U
+#EXT-X-VERSION:9
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:CAN-SKIP-UNTIL=12.0
+#EXTINF:4,
+segment.ts
+`, 4, Error},
+		{"llhls-part-hold-back-missing", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-PART-INF:PART-TARGET=1.0
+#EXTINF:4,
+segment.ts
+`, 3, Error},
+		{"llhls-part-hold-back-missing", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:HOLD-BACK=12.0
+#EXT-X-PART-INF:PART-TARGET=1.0
+#EXTINF:4,
+segment.ts
+`, 3, Error},
+		{"llhls-part-hold-back", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=1.5
+#EXT-X-PART-INF:PART-TARGET=1.0
+#EXTINF:4,
+segment.ts
+`, 3, Error},
+		{"llhls-part-hold-back-short", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=2.5
+#EXT-X-PART-INF:PART-TARGET=1.0
+#EXTINF:4,
+segment.ts
+`, 3, Warning},
+		{"llhls-part-inf-missing", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-PART:DURATION=1.0,URI="part1.mp4"
+#EXTINF:4,
+segment.ts
+`, 3, Error},
+		{"llhls-part-exceeds-part-target", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.0
+#EXT-X-PART-INF:PART-TARGET=1.0
+#EXT-X-PART:DURATION=1.5,URI="part1.mp4"
+`, 5, Error},
+		{"llhls-part-too-short", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.0
+#EXT-X-PART-INF:PART-TARGET=1.0
+#EXT-X-PART:DURATION=0.5,URI="part1.mp4"
+#EXT-X-PART:DURATION=1.0,URI="part2.mp4"
+`, 5, Error},
+		{"llhls-part-not-independent", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.0
+#EXT-X-PART-INF:PART-TARGET=1.0
+#EXT-X-PART:DURATION=1.0,URI="part1.mp4"
+`, 6, Error},
+		{"llhls-first-part-not-independent", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.0
+#EXT-X-PART-INF:PART-TARGET=1.0
+#EXT-X-PART:DURATION=1.0,URI="part1.mp4",INDEPENDENT=YES
+#EXTINF:1,
+segment1.mp4
+#EXT-X-PART:DURATION=1.0,URI="part2.mp4"
+`, 8, Warning},
+		{"llhls-preload-hint-placement", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.0
+#EXT-X-PART-INF:PART-TARGET=1.0
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="part1.mp4"
+#EXT-X-PART:DURATION=1.0,URI="part1.mp4",INDEPENDENT=YES
+`, 5, Error},
+		{"llhls-preload-hint-duplicated", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.0
+#EXT-X-PART-INF:PART-TARGET=1.0
+#EXT-X-PART:DURATION=1.0,URI="part1.mp4",INDEPENDENT=YES
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="part2.mp4"
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="part3.mp4"
+`, 7, Error},
+		{"llhls-preload-hint-endlist", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.0
+#EXT-X-PART-INF:PART-TARGET=1.0
+#EXT-X-PART:DURATION=1.0,URI="part1.mp4",INDEPENDENT=YES
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="part2.mp4"
+#EXT-X-ENDLIST
+`, 6, Warning},
+		{"llhls-rendition-report-missing", `#EXTM3U
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.0
+#EXT-X-PART-INF:PART-TARGET=1.0
+#EXT-X-PART:DURATION=1.0,URI="part1.mp4",INDEPENDENT=YES
+`, 0, Warning},
+	}
+
+	for _, test := range tests {
+		findings := ValidateString(test.playlist)
+		got := finding(findings, test.rule)
+		if got == nil {
+			t.Errorf("%s: no finding in %v", test.rule, findings)
+			continue
+		}
+		if got.Line != test.line || got.Severity != test.severity {
+			t.Errorf("%s: got %s, want line %d and severity %s", test.rule, got, test.line, test.severity)
+		}
+	}
+}
+
+func TestKeyFormat(t *testing.T) {
+	findings := ValidateString(`#EXTM3U
+#EXT-X-VERSION:5
+#EXT-X-TARGETDURATION:10
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="key.bin",KEYFORMAT="identity"
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin"
+#EXTINF:10,
+segment.ts
+#EXT-X-ENDLIST
+`)
+	if got := finding(findings, "key-keyformat-missing"); got != nil {
+		t.Errorf("unexpected finding %s", got)
+	}
+}
+
+func TestMalformedEXTINF(t *testing.T) {
+	findings := ValidateString(`#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXTINF:abc,
+segment.ts
+`)
+	// the malformed #EXTINF still belongs to the segment
+	for _, rule := range []string{"tag-unknown", "extinf-missing"} {
+		if got := finding(findings, rule); got != nil {
+			t.Errorf("unexpected finding %s", got)
+		}
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	for _, name := range []string{"sample.m3u8", "input.m3u8"} {
+		data, err := os.ReadFile(filepath.Join("..", "..", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, finding := range ValidateString(string(data)) {
+			t.Errorf("%s: unexpected finding %s", name, finding)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package validate
+
+import (
+	"math"
+	"strings"
+
+	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
+)
+
+// rules checked against the protocol version compatibility requirements
+var (
+	ruleVersionTooLow     = rule{"version-too-low", Error, "7", rfc8216}
+	ruleVersionTooLowBis  = rule{"version-too-low", Error, "8", rfc8216bis}
+	ruleAllowCacheRemoved = rule{"allow-cache-removed", Warning, "7", rfc8216}
+)
+
+// checkVersion checks that the declared protocol version supports every
+// feature used by the playlist, reporting each feature on the first line
+// that uses it
+func checkVersion(v *validation) {
+	declared := v.manifest.Version
+	number := 0
+	for _, l := range v.lines {
+		switch l.tagType {
+		case "version":
+			if number == 0 {
+				number = l.number
+			}
+		case "allow-cache":
+			if declared >= 7 {
+				v.report(ruleAllowCacheRemoved, l.number, "#EXT-X-ALLOW-CACHE was removed in protocol version 7")
+			}
+		}
+	}
+	if declared == 0 {
+		declared = 1
+	}
+
+	// the first line that uses each feature
+	first := make(map[string]int)
+	for _, l := range v.lines {
+		for _, feature := range features(l) {
+			if _, ok := first[feature]; !ok {
+				first[feature] = l.number
+			}
+		}
+	}
+
+	for _, requirement := range v.manifest.VersionRequirements() {
+		if requirement.Version > declared {
+			// versions above 7 were introduced by the second edition
+			r := ruleVersionTooLow
+			if requirement.Version > 7 {
+				r = ruleVersionTooLowBis
+			}
+			line, ok := first[requirement.Feature]
+			if !ok {
+				line = number
+			}
+			v.report(r, line, "%s requires protocol version %d, but the playlist declares version %d",
+				requirement.Feature, requirement.Version, declared)
+		}
+	}
+}
+
+// features returns the features a line uses, named like the Feature of the
+// parser.VersionRequirement they need
+func features(l *line) []string {
+	switch l.tagType {
+	case "i-frames-only", "byterange":
+		return []string{l.name()}
+
+	case "inf":
+		if duration, ok := l.event["duration"].(float64); ok && duration != math.Trunc(duration) {
+			return []string{"floating-point #EXTINF durations"}
+		}
+
+	case "key", "session-key":
+		found := []string{}
+		if _, ok := l.attributes["IV"]; ok {
+			found = append(found, l.name()+" with IV")
+		}
+		if keyFormat, ok := l.attributes["KEYFORMAT"]; ok && keyFormat != parser.DefaultKeyFormat {
+			found = append(found, l.name()+" with KEYFORMAT")
+		}
+		if versions, ok := l.attributes["KEYFORMATVERSIONS"]; ok && versions != "1" {
+			found = append(found, l.name()+" with KEYFORMATVERSIONS")
+		}
+		if method := l.attributes["METHOD"]; parser.EncryptionMethod(method).IsSampleEncryption() {
+			found = append(found, l.name()+" with METHOD="+method)
+		}
+		return found
+
+	case "map":
+		return []string{"#EXT-X-MAP", "#EXT-X-MAP without #EXT-X-I-FRAMES-ONLY"}
+
+	case "media":
+		if strings.HasPrefix(l.attributes["INSTREAM-ID"], "SERVICE") {
+			return []string{"INSTREAM-ID with a SERVICE value"}
+		}
+
+	case "define":
+		return []string{"variable substitution with #EXT-X-DEFINE"}
+
+	case "skip":
+		if _, ok := l.attributes["RECENTLY-REMOVED-DATERANGES"]; ok {
+			return []string{"#EXT-X-SKIP", "#EXT-X-SKIP replacing #EXT-X-DATERANGE tags"}
+		}
+		return []string{"#EXT-X-SKIP"}
+
+	case "stream-inf", "i-frame-playlist":
+		found := []string{}
+		for name := range l.attributes {
+			if strings.HasPrefix(name, "REQ-") {
+				found = append(found, name+" attribute")
+			}
+		}
+		return found
+	}
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/ar13101085/go-m3u8-parser/m3u8/parser"
 )
@@ -21,9 +22,7 @@ func main() {
 		log.Fatalf("Error reading file: %v", err)
 	}
 	// Parse the m3u8 content
-	p := parser.NewParser(map[string]interface{}{
-		"uri": filePath,
-	})
+	p := parser.New(parser.WithURI(filePath))
 
 	p.Push(string(data))
 	p.End()
@@ -64,18 +63,18 @@ func main() {
 		}
 	}
 
-	if p.Manifest.ServerControl != nil {
+	if serverControl := p.Manifest.ServerControl; serverControl != nil {
 		fmt.Printf("\nServer Control:\n")
-		for k, v := range p.Manifest.ServerControl {
-			fmt.Printf("  %s: %v\n", k, v)
-		}
+		fmt.Printf("  Can Skip Until: %v\n", serverControl.CanSkipUntil)
+		fmt.Printf("  Can Skip Date Ranges: %v\n", serverControl.CanSkipDateRanges)
+		fmt.Printf("  Hold Back: %v\n", serverControl.HoldBack)
+		fmt.Printf("  Part Hold Back: %v\n", serverControl.PartHoldBack)
+		fmt.Printf("  Can Block Reload: %v\n", serverControl.CanBlockReload)
 	}
 
 	if p.Manifest.PartInf != nil {
 		fmt.Printf("\nPart Inf:\n")
-		for k, v := range p.Manifest.PartInf {
-			fmt.Printf("  %s: %v\n", k, v)
-		}
+		fmt.Printf("  Part Target: %v\n", p.Manifest.PartInf.PartTarget)
 	}
 
 	if len(p.Manifest.Segments) > 0 {
@@ -95,6 +94,14 @@ func main() {
 				fmt.Printf("    Discontinuity: true\n")
 			}
 
+			if segment.Gap {
+				fmt.Printf("    Gap: true\n")
+			}
+
+			if segment.Bitrate != 0 {
+				fmt.Printf("    Bitrate: %d kbps\n", segment.Bitrate)
+			}
+
 			if segment.ProgramDateTime != 0 {
 				fmt.Printf("    Program Date Time: %d\n", segment.ProgramDateTime)
 			}
@@ -133,19 +140,14 @@ func main() {
 			fmt.Printf("  Playlist %d:\n", i+1)
 			fmt.Printf("    URI: %s\n", playlist.URI)
 
-			if playlist.Attributes != nil {
-				// Display bandwidth information if available
-				if bandwidth, ok := playlist.Attributes["BANDWIDTH"]; ok {
-					fmt.Printf("    Bandwidth: %s\n", bandwidth)
-				}
-				// Display resolution if available
-				if resolution, ok := playlist.Attributes["RESOLUTION"]; ok {
-					fmt.Printf("    Resolution: %s\n", resolution)
-				}
-				// Display codecs if available
-				if codecs, ok := playlist.Attributes["CODECS"]; ok {
-					fmt.Printf("    Codecs: %s\n", codecs)
-				}
+			fmt.Printf("    Bandwidth: %d\n", playlist.Bandwidth)
+			// Display resolution if available
+			if playlist.Resolution != nil {
+				fmt.Printf("    Resolution: %dx%d\n", playlist.Resolution.Width, playlist.Resolution.Height)
+			}
+			// Display codecs if available
+			if len(playlist.Codecs) > 0 {
+				fmt.Printf("    Codecs: %s\n", strings.Join(playlist.Codecs, ", "))
 			}
 		}
 	}
@@ -155,9 +157,9 @@ func main() {
 		for i, playlist := range p.Manifest.IFramePlaylists {
 			fmt.Printf("  I-Frame Playlist %d:\n", i+1)
 			fmt.Printf("    URI: %s\n", playlist.URI)
-			if playlist.Attributes != nil {
-				fmt.Printf("    Bandwidth: %s\n", playlist.Attributes["BANDWIDTH"])
-				fmt.Printf("    Resolution: %s\n", playlist.Attributes["RESOLUTION"])
+			fmt.Printf("    Bandwidth: %d\n", playlist.Bandwidth)
+			if playlist.Resolution != nil {
+				fmt.Printf("    Resolution: %dx%d\n", playlist.Resolution.Width, playlist.Resolution.Height)
 			}
 		}
 	}